@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cache"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
 	service2 "github.com/chill-cloud/chill-cli/pkg/service"
 	"github.com/chill-cloud/chill-cli/pkg/version/constraint"
 	"github.com/chill-cloud/chill-cli/pkg/version/set"
@@ -48,7 +47,7 @@ func RunAddLocal(cmd *cobra.Command, args []string) error {
 
 func runAddGeneric(src cache.CachedSource, version *string,
 	f func(string, constraint.Constraint) service2.Dependency) error {
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
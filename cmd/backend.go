@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/serving/pkg/apis/serving"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	v12 "knative.dev/serving/pkg/client/clientset/versioned/typed/serving/v1"
+	"sort"
+	"time"
+)
+
+const (
+	backendKnative    = "knative"
+	backendKubernetes = "kubernetes"
+)
+
+// deployBackend applies built versions of services to the cluster
+type deployBackend interface {
+	// IsLive reports whether the current version of the service has been deployed already
+	IsLive(cfg *service.ProjectConfig) (bool, error)
+	// Deploy applies the current version of the service; the lock of the major service must be held
+	Deploy(cfg *service.ProjectConfig, name string, steps []int) error
+	// Wait waits until the current version of the service becomes ready
+	Wait(cfg *service.ProjectConfig, name string, timeout time.Duration) error
+	// LiveVersions returns versions of the major service deployed to the cluster, whether serving or not
+	LiveVersions(cfg *service.ProjectConfig, major int) (map[version.Version]bool, error)
+	// Traffic returns versions of the major service reachable by their own hosts along with their
+	// shares of its traffic
+	Traffic(cfg *service.ProjectConfig, major int) (map[version.Version]versionTraffic, error)
+	// SetTraffic splits the traffic of the major service between its versions, the ones not mentioned
+	// receive none; the lock of the major service must be held
+	SetTraffic(cfg *service.ProjectConfig, major int, percents map[version.Version]int64) error
+	// Prune removes versions of the major service receiving no traffic along with their plain configuration,
+	// except for the keep most recent ones and the pinned ones; the lock of the major service must be held
+	Prune(cfg *service.ProjectConfig, major int, keep int, pinned map[version.Version][]string) error
+	// Undeploy removes the major service along with all its versions; the lock of the major service must be held
+	Undeploy(cfg *service.ProjectConfig, major int) error
+	// Dependents lists live versions of other services referring to the service
+	Dependents(name string) ([]dependent, error)
+}
+
+// versionTraffic is the share of the traffic of the major service received by one of its versions
+type versionTraffic struct {
+	// Revision is the name the version is deployed under
+	Revision string
+	Percent  int64
+}
+
+func newDeployBackend(clusterManager cluster.ClusterManager) (deployBackend, error) {
+	switch Backend {
+	case backendKnative:
+		knative, err := clusterManager.GetKnative()
+		if err != nil {
+			return nil, fmt.Errorf("unable to build Knative client")
+		}
+		return &knativeBackend{clusterManager: clusterManager, knative: knative}, nil
+	case backendKubernetes:
+		k8sClient, err := clusterManager.GetKubernetesClient()
+		if err != nil {
+			return nil, fmt.Errorf("unable to build Kubernetes client")
+		}
+		return &kubernetesBackend{clusterManager: clusterManager, k8sClient: k8sClient}, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %s", Backend)
+	}
+}
+
+// knativeBackend deploys every major version as a Knative service with a revision per version
+type knativeBackend struct {
+	clusterManager cluster.ClusterManager
+	knative        v12.ServingV1Interface
+}
+
+func (b *knativeBackend) IsLive(cfg *service.ProjectConfig) (bool, error) {
+	name := b.clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+	existingService, created, err := getKnativeService(b.knative, name)
+	if err != nil || !created {
+		return false, err
+	}
+	tag := cluster.RevisionTag(*cfg.CurrentVersion)
+	for _, t := range existingService.Status.Traffic {
+		if t.Tag == tag {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// LiveVersions takes versions of all the revisions, since revisions scaled to zero still pull
+// their images once they receive requests
+func (b *knativeBackend) LiveVersions(cfg *service.ProjectConfig, major int) (map[version.Version]bool, error) {
+	name := b.clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: major})
+	revisions, err := b.knative.Revisions(KubeNamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", serving.ConfigurationLabelKey, name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list revisions: %w", err)
+	}
+	res := map[version.Version]bool{}
+	for i := range revisions.Items {
+		if v := revisionVersion(&revisions.Items[i]); v != nil {
+			res[*v] = true
+		}
+	}
+	return res, nil
+}
+
+func (b *knativeBackend) Deploy(cfg *service.ProjectConfig, name string, steps []int) error {
+	existingService, created, err := getKnativeService(b.knative, name)
+	if err != nil {
+		return err
+	}
+
+	service, err := buildService(cfg, b.clusterManager, existingService)
+	if err != nil {
+		return err
+	}
+
+	if len(steps) > 0 {
+		if !created {
+			return fmt.Errorf("canary rollout requires the service to be deployed already")
+		}
+		return runCanary(cfg, b.clusterManager, b.knative, name, existingService, service, steps)
+	}
+
+	return applyKnativeService(b.knative, name, existingService, created, service)
+}
+
+// applyKnativeService creates the service or updates the existing one
+func applyKnativeService(
+	knative v12.ServingV1Interface,
+	name string,
+	existingService *servingv1.Service,
+	created bool,
+	service *servingv1.Service,
+) error {
+	if created {
+		service.SetResourceVersion(existingService.GetResourceVersion())
+		service.ObjectMeta = existingService.ObjectMeta
+		_, err := knative.Services(KubeNamespace).Update(context.TODO(), service, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("Knative server error while creating: %w\n", err)
+		}
+	} else {
+		service.ObjectMeta = metav1.ObjectMeta{
+			Name: name,
+		}
+		_, err := knative.Services(KubeNamespace).Create(context.TODO(), service, metav1.CreateOptions{})
+
+		if err != nil {
+			return fmt.Errorf("Knative server error while updating: %w\n", err)
+		}
+	}
+	return nil
+}
+
+func (b *knativeBackend) Wait(cfg *service.ProjectConfig, name string, timeout time.Duration) error {
+	return waitForService(b.clusterManager, name, timeout)
+}
+
+// majorService fetches the Knative service of the major version
+func (b *knativeBackend) majorService(cfg *service.ProjectConfig, major int) (*servingv1.Service, error) {
+	name := b.clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: major})
+	svc, err := b.knative.Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch the service: %w", err)
+	}
+	return svc, nil
+}
+
+func (b *knativeBackend) Traffic(cfg *service.ProjectConfig, major int) (map[version.Version]versionTraffic, error) {
+	svc, err := b.majorService(cfg, major)
+	if err != nil {
+		return nil, err
+	}
+	revisions, err := revisionVersions(b.clusterManager, svc)
+	if err != nil {
+		return nil, err
+	}
+	res := map[version.Version]versionTraffic{}
+	for v, t := range revisions {
+		var percent int64
+		if t.Percent != nil {
+			percent = *t.Percent
+		}
+		res[v] = versionTraffic{Revision: t.RevisionName, Percent: percent}
+	}
+	return res, nil
+}
+
+func (b *knativeBackend) SetTraffic(cfg *service.ProjectConfig, major int, percents map[version.Version]int64) error {
+	svc, err := b.majorService(cfg, major)
+	if err != nil {
+		return err
+	}
+	revisions, err := revisionVersions(b.clusterManager, svc)
+	if err != nil {
+		return err
+	}
+	for v := range percents {
+		t, ok := revisions[v]
+		if !ok {
+			return fmt.Errorf("version %s has never been deployed", v.String())
+		}
+		_, err := b.knative.Revisions(KubeNamespace).Get(context.TODO(), t.RevisionName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("unable to fetch revision of version %s: %w", v.String(), err)
+		}
+	}
+
+	trafficList, err := cluster.RetargetTraffic(svc.Status.Traffic, major, percents)
+	if err != nil {
+		return err
+	}
+	svc.Spec.RouteSpec.Traffic = trafficList
+	_, err = b.knative.Services(KubeNamespace).Update(context.TODO(), svc, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("Knative server error while updating: %w\n", err)
+	}
+	return nil
+}
+
+func (b *knativeBackend) Prune(cfg *service.ProjectConfig, major int, keep int, pinned map[version.Version][]string) error {
+	svc, err := b.majorService(cfg, major)
+	if err != nil {
+		return err
+	}
+	revisions, err := b.knative.Revisions(KubeNamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", serving.ConfigurationLabelKey, svc.Name),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list revisions: %w", err)
+	}
+
+	busy := map[string]bool{
+		svc.Status.LatestCreatedRevisionName: true,
+		svc.Status.LatestReadyRevisionName:   true,
+	}
+	for _, t := range svc.Status.Traffic {
+		if t.Percent != nil && *t.Percent > 0 {
+			busy[t.RevisionName] = true
+		}
+	}
+	var candidates []servingv1.Revision
+	for _, r := range revisions.Items {
+		if !busy[r.Name] {
+			candidates = append(candidates, r)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[j].CreationTimestamp.Before(&candidates[i].CreationTimestamp)
+	})
+	if len(candidates) <= keep {
+		println("Nothing to prune")
+		return nil
+	}
+	candidates = candidates[keep:]
+
+	removed := map[string]*version.Version{}
+	for i := range candidates {
+		r := &candidates[i]
+		v := revisionVersion(r)
+		if v != nil && len(pinned[*v]) > 0 {
+			fmt.Printf("Revision %s of version %s is kept, it is used by %v\n", r.Name, v.String(), pinned[*v])
+			continue
+		}
+		removed[r.Name] = v
+	}
+	if len(removed) == 0 {
+		println("Nothing to prune")
+		return nil
+	}
+
+	// Revisions referenced by the route can not be deleted, so the route is cleaned up first
+	var trafficList []servingv1.TrafficTarget
+	for _, t := range svc.Spec.Traffic {
+		if _, ok := removed[t.RevisionName]; !ok {
+			trafficList = append(trafficList, t)
+		}
+	}
+	if len(trafficList) != len(svc.Spec.Traffic) {
+		svc.Spec.RouteSpec.Traffic = trafficList
+		_, err = b.knative.Services(KubeNamespace).Update(context.TODO(), svc, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("Knative server error while updating: %w\n", err)
+		}
+	}
+
+	// Several revisions might share a version, its configuration is kept while any of them remains
+	remaining := map[version.Version]bool{}
+	for i := range revisions.Items {
+		r := &revisions.Items[i]
+		if _, ok := removed[r.Name]; ok {
+			continue
+		}
+		if v := revisionVersion(r); v != nil {
+			remaining[*v] = true
+		}
+	}
+
+	unused := map[version.Version]bool{}
+	for revisionName, v := range removed {
+		err = b.knative.Revisions(KubeNamespace).Delete(context.TODO(), revisionName, metav1.DeleteOptions{})
+		if err != nil {
+			return fmt.Errorf("Knative server error while deleting: %w\n", err)
+		}
+		if v != nil && !remaining[*v] {
+			unused[*v] = true
+		}
+		fmt.Printf("Revision %s removed\n", revisionName)
+	}
+	for v := range unused {
+		err = deleteConfigMap(b.clusterManager, configMapName(cfg.Name, v, b.clusterManager))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *knativeBackend) Undeploy(cfg *service.ProjectConfig, major int) error {
+	name := b.clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: major})
+	// Revisions are owned by the service, so they are garbage collected along with it
+	err := b.knative.Services(KubeNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("Knative server error while deleting: %w\n", err)
+	}
+	return nil
+}
+
+func (b *knativeBackend) Dependents(name string) ([]dependent, error) {
+	return findDependents(b.clusterManager, b.knative, name)
+}
@@ -0,0 +1,591 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/chill-cloud/chill-cli/pkg/version/set"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	errors2 "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	labelService  = "chill.cloud/service"
+	labelMajor    = "chill.cloud/major"
+	labelRevision = "chill.cloud/revision"
+	// labelServing tells the serving deployment of a version, whose pods are the only ones the major service
+	// routes to, from its standby one; pods never change it, so traffic changes only scale deployments
+	labelServing      = "chill.cloud/serving"
+	annotationVersion = "chill.cloud/version"
+	// annotationTraffic keeps the percent of the traffic of the major service the replicas approximate
+	annotationTraffic = "chill.cloud/traffic-percent"
+)
+
+// kubernetesBackend deploys every version as a Deployment with its own Service, while
+// a Service per major version spreads traffic between pods of all the serving versions;
+// the traffic split is approximated by numbers of replicas. Versions receiving no traffic
+// of the major service keep a replica in a standby Deployment reachable by their own hosts only
+type kubernetesBackend struct {
+	clusterManager cluster.ClusterManager
+	k8sClient      kubernetes.Interface
+}
+
+func (b *kubernetesBackend) IsLive(cfg *service.ProjectConfig) (bool, error) {
+	path := b.clusterManager.GetRevisionPath(cfg.Name, *cfg.CurrentVersion)
+	_, err := b.k8sClient.AppsV1().Deployments(KubeNamespace).Get(context.TODO(), path, metav1.GetOptions{})
+	if errors2.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// liveDeployments returns serving deployments of the major version by their versions
+func (b *kubernetesBackend) liveDeployments(name string, major int) (map[version.Version]*appsv1.Deployment, error) {
+	list, err := b.k8sClient.AppsV1().Deployments(KubeNamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(labels.Set{
+			labelService: name,
+			labelMajor:   strconv.Itoa(major),
+			labelServing: "true",
+		}).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list deployments: %w", err)
+	}
+	res := map[version.Version]*appsv1.Deployment{}
+	for i := range list.Items {
+		d := &list.Items[i]
+		v, err := version.ParseFromString(d.Annotations[annotationVersion])
+		if err != nil {
+			return nil, fmt.Errorf("deployment %s has wrong version: %w", d.Name, err)
+		}
+		res[*v] = d
+	}
+	return res, nil
+}
+
+// LiveVersions takes versions of all the serving deployments, since every version keeps running pods
+// whether it serves the major service or not
+func (b *kubernetesBackend) LiveVersions(cfg *service.ProjectConfig, major int) (map[version.Version]bool, error) {
+	live, err := b.liveDeployments(cfg.Name, major)
+	if err != nil {
+		return nil, err
+	}
+	res := map[version.Version]bool{}
+	for v := range live {
+		res[v] = true
+	}
+	return res, nil
+}
+
+// trafficPercents computes shares of the traffic of the versions once the current one is deployed;
+// the ones missing from the result are left untouched
+func (b *kubernetesBackend) trafficPercents(
+	cfg *service.ProjectConfig,
+	live map[version.Version]*appsv1.Deployment,
+) (map[version.Version]int64, error) {
+	if !version.IsProduction(*cfg.CurrentVersion) {
+		// Development versions receive no traffic of the major service
+		return map[version.Version]int64{*cfg.CurrentVersion: 0}, nil
+	}
+
+	var versions []version.Version
+	for v := range live {
+		versions = append(versions, v)
+	}
+	latest := set.ArrayVersionSet(versions).GetLatestProductionVersion()
+	if latest != nil && latest.Compare(*cfg.CurrentVersion) != 0 && !latest.MayBeNext(cfg.CurrentVersion) {
+		println("Wrong deploying order; retry might help")
+		return nil, errRetryLocked
+	}
+
+	targets, err := cfg.GetTrafficTargets()
+	if err != nil {
+		return nil, err
+	}
+	percents := map[version.Version]int64{}
+	for v := range live {
+		percents[v] = 0
+	}
+	for v, p := range targets {
+		if _, ok := live[v]; !ok && v != *cfg.CurrentVersion {
+			return nil, fmt.Errorf("no deployment found for version %s", v.String())
+		}
+		percents[v] = int64(p)
+	}
+	if _, ok := percents[*cfg.CurrentVersion]; !ok {
+		percents[*cfg.CurrentVersion] = 0
+	}
+	return percents, nil
+}
+
+// replicaCounts approximates the traffic split by replicas of the versions
+func (b *kubernetesBackend) replicaCounts(cfg *service.ProjectConfig, percents map[version.Version]int64) map[version.Version]int32 {
+	var minReplicas, maxReplicas int32
+	if cfg.Runtime != nil {
+		minReplicas = optionalInt32(cfg.Runtime.MinScale)
+		maxReplicas = optionalInt32(cfg.Runtime.MaxScale)
+	}
+	return cluster.ReplicaCounts(percents, minReplicas, maxReplicas)
+}
+
+// replicasOf returns the desired number of replicas of the deployment
+func replicasOf(d *appsv1.Deployment) int32 {
+	if d.Spec.Replicas == nil {
+		return 1
+	}
+	return *d.Spec.Replicas
+}
+
+// scale applies the traffic split to the deployments; the ones missing from percents are left untouched.
+// Versions gaining serving replicas are scaled first, so the major service keeps endpoints in between
+func (b *kubernetesBackend) scale(
+	cfg *service.ProjectConfig,
+	live map[version.Version]*appsv1.Deployment,
+	percents map[version.Version]int64,
+) error {
+	counts := b.replicaCounts(cfg, percents)
+	var versions []version.Version
+	for v := range live {
+		if _, ok := counts[v]; ok {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return counts[versions[i]]-replicasOf(live[versions[i]]) > counts[versions[j]]-replicasOf(live[versions[j]])
+	})
+	deployments := b.k8sClient.AppsV1().Deployments(KubeNamespace)
+	for _, v := range versions {
+		d, r := live[v], counts[v]
+		d.Spec.Replicas = &r
+		if d.Annotations == nil {
+			d.Annotations = map[string]string{}
+		}
+		d.Annotations[annotationTraffic] = strconv.FormatInt(percents[v], 10)
+		_, err := deployments.Update(context.TODO(), d, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("Kubernetes server error while scaling deployment %s: %w\n", d.Name, err)
+		}
+		name := standbyName(d.Name)
+		standby, err := deployments.Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("Kubernetes server error while getting deployment %s: %w\n", name, err)
+		}
+		standbyReplicas := standbyReplicas(r)
+		standby.Spec.Replicas = &standbyReplicas
+		_, err = deployments.Update(context.TODO(), standby, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("Kubernetes server error while scaling deployment %s: %w\n", name, err)
+		}
+	}
+	return nil
+}
+
+// checkRuntime rejects settings implemented by the Knative autoscaler and queue proxy only
+func (b *kubernetesBackend) checkRuntime(r *service.RuntimeConfig) error {
+	if r == nil {
+		return nil
+	}
+	var unsupported []string
+	if r.ContainerConcurrency != nil {
+		unsupported = append(unsupported, "containerConcurrency")
+	}
+	if r.TargetConcurrency != nil {
+		unsupported = append(unsupported, "targetConcurrency")
+	}
+	if r.TimeoutSeconds != nil {
+		unsupported = append(unsupported, "timeoutSeconds")
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("runtime settings %s are only supported by the %s backend",
+			strings.Join(unsupported, ", "), backendKnative)
+	}
+	return nil
+}
+
+// standbyReplicas keeps a replica of versions receiving no traffic of the major service,
+// since dependents might still reach them by their own hosts
+func standbyReplicas(serving int32) int32 {
+	if serving == 0 {
+		return 1
+	}
+	return 0
+}
+
+// standbyName is the name of the standby deployment of the version deployed under the path
+func standbyName(path string) string {
+	return path + "-standby"
+}
+
+// buildDeployments computes the serving and the standby deployments of the current version; serving replicas
+// approximate the percent of the traffic of the major service
+func (b *kubernetesBackend) buildDeployments(
+	cfg *service.ProjectConfig,
+	replicas int32,
+	percent int64,
+) (*appsv1.Deployment, *appsv1.Deployment, error) {
+	template, err := buildRevisionTemplate(cfg, b.clusterManager)
+	if err != nil {
+		return nil, nil, err
+	}
+	applyRuntime(template, cfg.Runtime)
+	applyProbes(template, cfg)
+	podSpec := template.Spec.PodSpec
+	// Unlike Knative, Kubernetes does not infer probe ports
+	for i := range podSpec.Containers {
+		for _, p := range []*v1.Probe{podSpec.Containers[i].LivenessProbe, podSpec.Containers[i].ReadinessProbe} {
+			if p != nil && p.HTTPGet != nil {
+				p.HTTPGet.Port = intstr.FromInt(int(servicePort))
+			}
+			if p != nil && p.TCPSocket != nil {
+				p.TCPSocket.Port = intstr.FromInt(int(servicePort))
+			}
+		}
+	}
+
+	path := b.clusterManager.GetRevisionPath(cfg.Name, *cfg.CurrentVersion)
+	serving := b.deployment(cfg, path, path, true, replicas, podSpec)
+	serving.Annotations[annotationTraffic] = strconv.FormatInt(percent, 10)
+	standby := b.deployment(cfg, standbyName(path), path, false, standbyReplicas(replicas), *podSpec.DeepCopy())
+	return serving, standby, nil
+}
+
+// deployment computes one of the deployments of the version deployed under the path
+func (b *kubernetesBackend) deployment(
+	cfg *service.ProjectConfig,
+	name string,
+	path string,
+	serving bool,
+	replicas int32,
+	podSpec v1.PodSpec,
+) *appsv1.Deployment {
+	podLabels := b.labels(cfg, path, serving)
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: b.labels(cfg, path, serving),
+			Annotations: map[string]string{
+				annotationVersion: cfg.CurrentVersion.String(),
+			},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{
+					labelRevision: path,
+					labelServing:  podLabels[labelServing],
+				},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Labels: podLabels,
+				},
+				Spec: podSpec,
+			},
+		},
+	}
+}
+
+func (b *kubernetesBackend) labels(cfg *service.ProjectConfig, path string, serving bool) map[string]string {
+	return map[string]string{
+		labelService:  cfg.Name,
+		labelMajor:    strconv.Itoa(cfg.CurrentVersion.GetMajor()),
+		labelRevision: path,
+		labelServing:  strconv.FormatBool(serving),
+	}
+}
+
+// applyDeployment creates or updates the deployment
+func (b *kubernetesBackend) applyDeployment(d *appsv1.Deployment) error {
+	deployments := b.k8sClient.AppsV1().Deployments(KubeNamespace)
+	existing, err := deployments.Get(context.TODO(), d.Name, metav1.GetOptions{})
+	if errors2.IsNotFound(err) {
+		_, err = deployments.Create(context.TODO(), d, metav1.CreateOptions{})
+	} else if err == nil {
+		d.ObjectMeta.ResourceVersion = existing.ResourceVersion
+		_, err = deployments.Update(context.TODO(), d, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("Kubernetes server error while applying deployment %s: %w\n", d.Name, err)
+	}
+	return nil
+}
+
+// applyK8sService creates or updates the service routing to pods matching the selector
+func (b *kubernetesBackend) applyK8sService(name string, selector map[string]string) error {
+	services := b.k8sClient.CoreV1().Services(KubeNamespace)
+	ports := []v1.ServicePort{
+		{
+			Name:       "h2c",
+			Protocol:   v1.ProtocolTCP,
+			Port:       servicePort,
+			TargetPort: intstr.FromInt(int(servicePort)),
+		},
+	}
+	existing, err := services.Get(context.TODO(), name, metav1.GetOptions{})
+	if errors2.IsNotFound(err) {
+		_, err = services.Create(context.TODO(), &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: selector},
+			Spec: v1.ServiceSpec{
+				Selector: selector,
+				Ports:    ports,
+			},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Spec.Selector = selector
+	existing.Spec.Ports = ports
+	_, err = services.Update(context.TODO(), existing, metav1.UpdateOptions{})
+	return err
+}
+
+func (b *kubernetesBackend) Deploy(cfg *service.ProjectConfig, name string, steps []int) error {
+	if len(steps) > 0 {
+		return fmt.Errorf("canary rollout is only supported by the %s backend", backendKnative)
+	}
+	if err := b.checkRuntime(cfg.Runtime); err != nil {
+		return err
+	}
+	live, err := b.liveDeployments(cfg.Name, cfg.CurrentVersion.GetMajor())
+	if err != nil {
+		return err
+	}
+	percents, err := b.trafficPercents(cfg, live)
+	if err != nil {
+		return err
+	}
+
+	counts := b.replicaCounts(cfg, percents)
+	deployment, standby, err := b.buildDeployments(cfg, counts[*cfg.CurrentVersion], percents[*cfg.CurrentVersion])
+	if err != nil {
+		return err
+	}
+	for _, d := range []*appsv1.Deployment{deployment, standby} {
+		err = b.applyDeployment(d)
+		if err != nil {
+			return err
+		}
+	}
+
+	delete(live, *cfg.CurrentVersion)
+	err = b.scale(cfg, live, percents)
+	if err != nil {
+		return err
+	}
+
+	path := deployment.Name
+	err = b.applyK8sService(path, map[string]string{labelRevision: path})
+	if err != nil {
+		return fmt.Errorf("Kubernetes server error while applying service %s: %w\n", path, err)
+	}
+	err = b.applyK8sService(name, map[string]string{
+		labelService: cfg.Name,
+		labelMajor:   strconv.Itoa(cfg.CurrentVersion.GetMajor()),
+		labelServing: "true",
+	})
+	if err != nil {
+		return fmt.Errorf("Kubernetes server error while applying service %s: %w\n", name, err)
+	}
+	return nil
+}
+
+// Wait waits for both deployments of the version, since only one of them has replicas
+func (b *kubernetesBackend) Wait(cfg *service.ProjectConfig, name string, timeout time.Duration) error {
+	path := b.clusterManager.GetRevisionPath(cfg.Name, *cfg.CurrentVersion)
+	fmt.Printf("Waiting for deployment %s to become ready...\n", path)
+
+	var d *appsv1.Deployment
+	err := wait.PollImmediate(waitPollInterval, timeout, func() (bool, error) {
+		for _, n := range []string{path, standbyName(path)} {
+			var err error
+			d, err = b.k8sClient.AppsV1().Deployments(KubeNamespace).Get(context.TODO(), n, metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			replicas := replicasOf(d)
+			if d.Status.ObservedGeneration < d.Generation ||
+				d.Status.UpdatedReplicas != replicas ||
+				d.Status.AvailableReplicas != replicas {
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		for _, c := range d.Status.Conditions {
+			if c.Status != v1.ConditionTrue {
+				fmt.Printf("Deployment %s: condition %s is %s, reason: %s\n", d.Name, c.Type, c.Status, c.Reason)
+				if c.Message != "" {
+					fmt.Printf("  %s\n", c.Message)
+				}
+			}
+		}
+		return fmt.Errorf("deployment %s did not become ready in %s", d.Name, timeout.String())
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Deployment %s is ready\n", path)
+	return nil
+}
+
+// Traffic takes the percents recorded by the latest split, as replicas only approximate it
+func (b *kubernetesBackend) Traffic(cfg *service.ProjectConfig, major int) (map[version.Version]versionTraffic, error) {
+	live, err := b.liveDeployments(cfg.Name, major)
+	if err != nil {
+		return nil, err
+	}
+	if len(live) == 0 {
+		return nil, fmt.Errorf("major version %d is not deployed", major)
+	}
+	res := map[version.Version]versionTraffic{}
+	for v, d := range live {
+		// Deployments without the annotation have never received traffic
+		percent, _ := strconv.ParseInt(d.Annotations[annotationTraffic], 10, 64)
+		res[v] = versionTraffic{Revision: d.Name, Percent: percent}
+	}
+	return res, nil
+}
+
+func (b *kubernetesBackend) SetTraffic(cfg *service.ProjectConfig, major int, percents map[version.Version]int64) error {
+	live, err := b.liveDeployments(cfg.Name, major)
+	if err != nil {
+		return err
+	}
+	all := map[version.Version]int64{}
+	for v := range live {
+		all[v] = 0
+	}
+	var sum int64
+	for v, p := range percents {
+		if _, ok := live[v]; !ok {
+			return fmt.Errorf("version %s has never been deployed", v.String())
+		}
+		all[v] = p
+		sum += p
+	}
+	if sum != 100 {
+		return fmt.Errorf("sum of percents should be 100")
+	}
+	return b.scale(cfg, live, all)
+}
+
+// deleteVersion removes both deployments of the version along with its own service
+func (b *kubernetesBackend) deleteVersion(d *appsv1.Deployment) error {
+	for _, name := range []string{d.Name, standbyName(d.Name)} {
+		err := b.k8sClient.AppsV1().Deployments(KubeNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		if err != nil && !errors2.IsNotFound(err) {
+			return fmt.Errorf("Kubernetes server error while deleting deployment %s: %w\n", name, err)
+		}
+	}
+	err := b.k8sClient.CoreV1().Services(KubeNamespace).Delete(context.TODO(), d.Name, metav1.DeleteOptions{})
+	if err != nil && !errors2.IsNotFound(err) {
+		return fmt.Errorf("Kubernetes server error while deleting service %s: %w\n", d.Name, err)
+	}
+	return nil
+}
+
+// Prune never removes the most recent deployment, the same way Knative keeps the latest revision
+func (b *kubernetesBackend) Prune(cfg *service.ProjectConfig, major int, keep int, pinned map[version.Version][]string) error {
+	live, err := b.liveDeployments(cfg.Name, major)
+	if err != nil {
+		return err
+	}
+	var latest *appsv1.Deployment
+	for _, d := range live {
+		if latest == nil || latest.CreationTimestamp.Before(&d.CreationTimestamp) {
+			latest = d
+		}
+	}
+	var candidates []version.Version
+	for v, d := range live {
+		if d != latest && replicasOf(d) == 0 {
+			candidates = append(candidates, v)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return live[candidates[j]].CreationTimestamp.Before(&live[candidates[i]].CreationTimestamp)
+	})
+	removed := 0
+	if len(candidates) > keep {
+		for _, v := range candidates[keep:] {
+			d := live[v]
+			if len(pinned[v]) > 0 {
+				fmt.Printf("Deployment %s of version %s is kept, it is used by %v\n", d.Name, v.String(), pinned[v])
+				continue
+			}
+			err = b.deleteVersion(d)
+			if err != nil {
+				return err
+			}
+			err = deleteConfigMapWith(b.k8sClient, configMapName(cfg.Name, v, b.clusterManager))
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Deployment %s removed\n", d.Name)
+			removed++
+		}
+	}
+	if removed == 0 {
+		println("Nothing to prune")
+	}
+	return nil
+}
+
+func (b *kubernetesBackend) Undeploy(cfg *service.ProjectConfig, major int) error {
+	live, err := b.liveDeployments(cfg.Name, major)
+	if err != nil {
+		return err
+	}
+	name := b.clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: major})
+	err = b.k8sClient.CoreV1().Services(KubeNamespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if errors2.IsNotFound(err) && len(live) == 0 {
+		return fmt.Errorf("major version %d is not deployed", major)
+	}
+	if err != nil && !errors2.IsNotFound(err) {
+		return fmt.Errorf("Kubernetes server error while deleting service %s: %w\n", name, err)
+	}
+	for _, d := range live {
+		err = b.deleteVersion(d)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Dependents takes serving deployments of all versions of other services, since every version keeps running pods
+func (b *kubernetesBackend) Dependents(name string) ([]dependent, error) {
+	list, err := b.k8sClient.AppsV1().Deployments(KubeNamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s,%s=true", labelService, labelServing),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list deployments: %w", err)
+	}
+	var res []dependent
+	for i := range list.Items {
+		d, err := containerDependent(b.clusterManager, name, list.Items[i].Spec.Template.Spec.Containers)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			res = append(res, *d)
+		}
+	}
+	return res, nil
+}
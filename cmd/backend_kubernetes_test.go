@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func kubernetesTestConfig(v version.Version, targets map[version.Version]int) *service.ProjectConfig {
+	return &service.ProjectConfig{
+		Name:           "demo",
+		Registry:       "registry.example.com/team",
+		CurrentVersion: &v,
+		TrafficTargets: targets,
+	}
+}
+
+// checkReplicas makes sure deployments have the numbers of replicas, standby ones included
+func checkReplicas(t *testing.T, client *fake.Clientset, expected map[string]int32) {
+	for name, replicas := range expected {
+		d, err := client.AppsV1().Deployments(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replicasOf(d) != replicas {
+			t.Fatalf("deployment %s has %d replicas instead of %d", name, replicasOf(d), replicas)
+		}
+	}
+}
+
+// deploymentNames returns names of all the deployments left in the namespace
+func deploymentNames(t *testing.T, client *fake.Clientset) string {
+	list, err := client.AppsV1().Deployments(KubeNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range list.Items {
+		names = append(names, d.Name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func TestKubernetesBackend(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	b := &kubernetesBackend{clusterManager: cluster.NewOffline(KubeNamespace), k8sClient: client}
+	v11, v12, v13 := version.Version{Major: 1, Minor: 1}, version.Version{Major: 1, Minor: 2}, version.Version{Major: 1, Minor: 3}
+
+	for _, cfg := range []*service.ProjectConfig{
+		kubernetesTestConfig(v11, nil),
+		kubernetesTestConfig(v12, nil),
+		kubernetesTestConfig(v13, map[version.Version]int{v12: 90, v13: 10}),
+	} {
+		err := b.Deploy(cfg, "demo-v1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Versions receiving no traffic keep a standby replica only
+	checkReplicas(t, client, map[string]int32{
+		"v1-0-demo-v1": 0, "v1-0-demo-v1-standby": 1,
+		"v2-0-demo-v1": 9, "v2-0-demo-v1-standby": 0,
+		"v3-0-demo-v1": 1, "v3-0-demo-v1-standby": 0,
+	})
+	for _, name := range []string{"demo-v1", "v1-0-demo-v1", "v2-0-demo-v1", "v3-0-demo-v1"} {
+		_, err := client.CoreV1().Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := kubernetesTestConfig(v13, nil)
+	err := b.SetTraffic(cfg, 1, map[version.Version]int64{v12: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplicas(t, client, map[string]int32{
+		"v1-0-demo-v1": 0, "v1-0-demo-v1-standby": 1,
+		"v2-0-demo-v1": 1, "v2-0-demo-v1-standby": 0,
+		"v3-0-demo-v1": 0, "v3-0-demo-v1-standby": 1,
+	})
+	traffic, err := b.Traffic(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if traffic[v11].Percent != 0 || traffic[v12].Percent != 100 || traffic[v13].Percent != 0 {
+		t.Fatalf("wrong split recorded: %v", traffic)
+	}
+	err = b.SetTraffic(cfg, 1, map[version.Version]int64{v12: 50})
+	if err == nil {
+		t.Fatal("wrong sum accepted")
+	}
+
+	// The fake client leaves creation times empty, so they are set in the order of deploying
+	created := time.Now()
+	for i, name := range []string{"v1-0-demo-v1", "v2-0-demo-v1", "v3-0-demo-v1"} {
+		d, err := client.AppsV1().Deployments(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.CreationTimestamp = metav1.NewTime(created.Add(time.Duration(i) * time.Minute))
+		_, err = client.AppsV1().Deployments(KubeNamespace).Update(context.TODO(), d, metav1.UpdateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The latest version receives no traffic, yet it is kept
+	err = b.Prune(cfg, 1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := deploymentNames(t, client); names != "v2-0-demo-v1,v2-0-demo-v1-standby,v3-0-demo-v1,v3-0-demo-v1-standby" {
+		t.Fatalf("wrong deployments left after pruning: %s", names)
+	}
+	_, err = client.CoreV1().Services(KubeNamespace).Get(context.TODO(), "v1-0-demo-v1", metav1.GetOptions{})
+	if err == nil {
+		t.Fatal("service of the pruned version left")
+	}
+
+	err = b.Undeploy(cfg, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := deploymentNames(t, client); names != "" {
+		t.Fatalf("deployments left after undeploying: %s", names)
+	}
+	services, err := client.CoreV1().Services(KubeNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil || len(services.Items) != 0 {
+		t.Fatalf("services left after undeploying: %v %v", services, err)
+	}
+	err = b.Undeploy(cfg, 1)
+	if err == nil {
+		t.Fatal("missing major version undeployed")
+	}
+}
+
+func TestKubernetesBackendRuntime(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	b := &kubernetesBackend{clusterManager: cluster.NewOffline(KubeNamespace), k8sClient: client}
+	cfg := kubernetesTestConfig(version.Version{Major: 1, Minor: 1}, nil)
+	minScale, concurrency, timeout := 2, 10, 30
+	cfg.Runtime = &service.RuntimeConfig{
+		MinScale:             &minScale,
+		ContainerConcurrency: &concurrency,
+		TimeoutSeconds:       &timeout,
+	}
+	err := b.Deploy(cfg, "demo-v1", nil)
+	if err == nil || !strings.Contains(err.Error(), "containerConcurrency, timeoutSeconds") {
+		t.Fatalf("Knative only settings reported as %v", err)
+	}
+
+	cfg.Runtime.ContainerConcurrency, cfg.Runtime.TimeoutSeconds = nil, nil
+	err = b.Deploy(cfg, "demo-v1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkReplicas(t, client, map[string]int32{"v1-0-demo-v1": 2, "v1-0-demo-v1-standby": 0})
+}
@@ -2,19 +2,24 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cache"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
+	"github.com/chill-cloud/chill-cli/pkg/image"
 	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/progress"
+	"github.com/chill-cloud/chill-cli/pkg/service"
 	"github.com/docker/docker/api/types"
 	docker "github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
-	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/mitchellh/go-homedir"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/spf13/cobra"
 	"io"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
@@ -23,22 +28,65 @@ var buildCmd = &cobra.Command{
 	Use:   "build",
 	Short: "Builds an image of the service",
 	Long: `This command connects to the Docker daemon and tries to build
-your image declared in image/Dockerfile, then, if successful, 
-marks it with a tag of the current version.`,
+your image declared in image/Dockerfile (or the one set in the build
+section of the project config), then, if successful, marks it with
+a tag of the current version and the extra tags. If platforms are set,
+an image is built for each of them with a platform suffix in the tag;
+push combines them into an index under the version tag.`,
 	RunE: RunBuild,
 }
 
-func GetContext(filePath string) (io.Reader, error) {
+func GetContext(filePath string, excludes []string) (io.Reader, error) {
 	_, err := homedir.Expand(filePath)
 	if err != nil {
 		return nil, err
 	}
-	ctx, err := archive.TarWithOptions(filePath, &archive.TarOptions{})
+	ctx, err := archive.TarWithOptions(filePath, &archive.TarOptions{
+		ExcludePatterns: excludes,
+	})
 	return ctx, err
 }
 
+// applyBuildFlags overrides build settings of the project config with the ones set explicitly
+func applyBuildFlags(cmd *cobra.Command, cfg *service.ProjectConfig) error {
+	build := cfg.GetBuild()
+	if cmd.Flags().Changed("dockerfile") {
+		build.Dockerfile = buildDockerfile
+	}
+	if cmd.Flags().Changed("context") {
+		build.Context = buildContext
+	}
+	if cmd.Flags().Changed("target") {
+		build.Target = buildTarget
+	}
+	if len(buildArgs) > 0 {
+		args := map[string]string{}
+		for k, v := range build.Args {
+			args[k] = v
+		}
+		for _, a := range buildArgs {
+			parts := strings.SplitN(a, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("wrong build arg %s, KEY=VALUE expected", a)
+			}
+			args[parts[0]] = parts[1]
+		}
+		build.Args = args
+	}
+	build.Tags = append(build.Tags, buildTags...)
+	if cmd.Flags().Changed("platform") {
+		err := config.ValidatePlatforms(buildPlatformsFlag)
+		if err != nil {
+			return err
+		}
+		build.Platforms = buildPlatformsFlag
+	}
+	cfg.Build = &build
+	return nil
+}
+
 func RunBuild(cmd *cobra.Command, args []string) error {
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
@@ -47,55 +95,337 @@ func RunBuild(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
+	if cfg == nil {
+		return fmt.Errorf("no project config found")
+	}
+	err = cfg.ApplyEnvironment(Environment)
+	if err != nil {
+		return err
+	}
+	err = applyBuildFlags(cmd, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = buildImage(cwd, cfg)
+	if err != nil || !buildSBOM {
+		return err
+	}
+	return writeSBOM(cwd, cfg)
+}
+
+func buildTemplateData(cfg *service.ProjectConfig) service.BuildTemplateData {
+	return service.BuildTemplateData{
+		Name:    cfg.Name,
+		Version: cfg.CurrentVersion.String(),
+	}
+}
+
+// imageTags returns the versioned tag of the image followed by the extra ones in the same repository
+func imageTags(imageName string, cfg *service.ProjectConfig) ([]string, error) {
+	tags := []string{imageName}
+	repository := imageName[:strings.LastIndex(imageName, ":")]
+	for _, t := range cfg.GetBuild().Tags {
+		tag, err := service.RenderBuildTemplate(t, buildTemplateData(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("unable to render tag %s: %w", t, err)
+		}
+		tags = append(tags, fmt.Sprintf("%s:%s", repository, tag))
+	}
+	return tags, nil
+}
+
+// imageLabels returns OCI labels describing the service version; the revision is omitted
+// if the project is not a git repository
+func imageLabels(cwd string, cfg *service.ProjectConfig) map[string]string {
+	labels := map[string]string{
+		ocispec.AnnotationTitle:   cfg.Name,
+		ocispec.AnnotationVersion: cfg.CurrentVersion.String(),
+	}
+	s, err := cache.NewLocalSourceOfTruth(cwd)
+	if err == nil {
+		var revision string
+		revision, err = s.GetRevision()
+		if err == nil {
+			labels[ocispec.AnnotationRevision] = revision
+		}
+	}
+	if err != nil {
+		logging.Logger.Warn(fmt.Sprintf("Unable to get revision of the project: %s", err.Error()))
+	}
+	return labels
+}
+
+// buildContextDir returns the build context directory and the Dockerfile path relative to it
+func buildContextDir(cwd string, cfg *service.ProjectConfig) (string, string, error) {
+	build := cfg.GetBuild()
+	contextDir := filepath.Join(cwd, build.Context)
+	// Docker expects the Dockerfile path to be relative to the context
+	dockerfile, err := filepath.Rel(contextDir, filepath.Join(cwd, build.Dockerfile))
+	if err != nil || dockerfile == ".." || strings.HasPrefix(dockerfile, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("dockerfile %s must be inside the build context %s", build.Dockerfile, build.Context)
+	}
+	return contextDir, filepath.ToSlash(dockerfile), nil
+}
+
+// contextExcludes adds repository metadata, the lock file and the local state of the project to the
+// patterns of .dockerignore; secrets never reach the build context, and neither commits nor digests
+// recorded by push change the context hash
+func contextExcludes(cwd string, contextDir string, dockerfile string) ([]string, error) {
+	excludes, err := image.ContextExcludes(contextDir, dockerfile)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range []string{".git", config.LockConfigName, localStateDir} {
+		rel, err := filepath.Rel(contextDir, filepath.Join(cwd, p))
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		excludes = append(excludes, filepath.ToSlash(rel))
+	}
+	return excludes, nil
+}
+
+func renderBuildArgs(cfg *service.ProjectConfig) (map[string]*string, error) {
+	buildArgs := map[string]*string{}
+	for k, v := range cfg.GetBuild().Args {
+		value, err := service.RenderBuildTemplate(v, buildTemplateData(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("unable to render build arg %s: %w", k, err)
+		}
+		buildArgs[k] = &value
+	}
+	return buildArgs, nil
+}
+
+// contextHash identifies the image by everything it is built from; labels are left out, so
+// commits not touching the build context do not cause rebuilds
+func contextHash(cwd string, cfg *service.ProjectConfig, platforms ...string) (string, error) {
+	contextDir, dockerfile, err := buildContextDir(cwd, cfg)
+	if err != nil {
+		return "", err
+	}
+	excludes, err := contextExcludes(cwd, contextDir, dockerfile)
+	if err != nil {
+		return "", err
+	}
+	buildArgs, err := renderBuildArgs(cfg)
+	if err != nil {
+		return "", err
+	}
+	settings := []string{dockerfile, cfg.GetBuild().Target}
+	for k, v := range buildArgs {
+		settings = append(settings, fmt.Sprintf("%s=%s", k, *v))
+	}
+	sort.Strings(settings[2:])
+	for _, p := range platforms {
+		settings = append(settings, "platform="+p)
+	}
+	return image.ContextHash(contextDir, excludes, settings...)
+}
+
+// buildPlatforms returns platforms the image is built for, none meaning the native platform
+// of the daemon; images for a local cluster are native, as the cluster runs next to the daemon
+func buildPlatforms(cfg *service.ProjectConfig) []string {
+	_, isLocal := cfg.GetBuildTag(ForceLocal)
+	if isLocal {
+		return nil
+	}
+	return cfg.GetBuild().Platforms
+}
+
+// platformTag is the tag of the image for one of the platforms, the version tag is left for the index
+func platformTag(imageName string, platform string) string {
+	return fmt.Sprintf("%s-%s", imageName, strings.ReplaceAll(platform, "/", "-"))
+}
+
+// platformImage is an image built by the Docker daemon
+type platformImage struct {
+	// platform is empty for the native one
+	platform string
+	// tags start with the one the image is looked up by
+	tags []string
+	hash string
+}
+
+// platformImages lists images built for the current version: either the native one tagged
+// with all the tags or one per platform
+func platformImages(cwd string, cfg *service.ProjectConfig) ([]platformImage, error) {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	platforms := buildPlatforms(cfg)
+	if len(platforms) == 0 {
+		tags, err := imageTags(imageName, cfg)
+		if err != nil {
+			return nil, err
+		}
+		hash, err := contextHash(cwd, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return []platformImage{{tags: tags, hash: hash}}, nil
+	}
+	var res []platformImage
+	for _, p := range platforms {
+		hash, err := contextHash(cwd, cfg, p)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, platformImage{platform: p, tags: []string{platformTag(imageName, p)}, hash: hash})
+	}
+	return res, nil
+}
+
+// remoteImageUpToDate checks whether the version tag in the registry is built from the same context
+// and returns its digest if so
+func remoteImageUpToDate(cfg *service.ProjectConfig, hash string, auth authn.Authenticator) (string, error) {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	labels, digest, err := image.RemoteLabels(imageName, auth)
+	if err != nil || labels[image.ContextHashLabel] != hash {
+		return "", err
+	}
+	return digest, nil
+}
 
+// localImageUpToDate checks whether the Docker daemon has the image built from the same context
+// and makes sure the extra tags point to it
+func localImageUpToDate(ctx context.Context, cli *docker.Client, img platformImage) (bool, error) {
+	inspect, _, err := cli.ImageInspectWithRaw(ctx, img.tags[0])
+	if err != nil {
+		if docker.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if inspect.Config == nil || inspect.Config.Labels[image.ContextHashLabel] != img.hash {
+		return false, nil
+	}
+	for _, t := range img.tags[1:] {
+		err = cli.ImageTag(ctx, img.tags[0], t)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// buildImage builds images of the service located in the directory, unless the image of
+// the current version is built from the same context already
+func buildImage(cwd string, cfg *service.ProjectConfig) error {
 	logging.Logger.Info("Creating Docker client...")
 	cli, err := docker.NewClientWithOpts(docker.FromEnv)
 	if err != nil {
 		return fmt.Errorf("unable to connect to the Docker daemon: %w\n", err)
 	}
 	ctx := context.Background()
-	dockerCtx, err := GetContext(cwd)
-	if err != nil {
-		return fmt.Errorf("unable to create Docker context: %w\n", err)
-	}
-	imageName, _ := cfg.GetBuildTag(ForceLocal)
-	logging.Logger.Info(fmt.Sprintf("Building an image %s...", imageName))
-	resp, err := cli.ImageBuild(ctx, dockerCtx, types.ImageBuildOptions{
-		Dockerfile: "image/Dockerfile",
-		Tags:       []string{imageName},
-	})
+	imageName, isLocal := cfg.GetBuildTag(ForceLocal)
+	images, err := platformImages(cwd, cfg)
 	if err != nil {
-		return fmt.Errorf("unable to build image: %w\n", err)
+		return err
 	}
-	defer resp.Body.Close()
-	dec := json.NewDecoder(resp.Body)
-	for {
-		var jm jsonmessage.JSONMessage
-		if err := dec.Decode(&jm); err != nil {
-			if errors.Is(err, io.EOF) {
+	if !forceBuild {
+		upToDate := true
+		for _, img := range images {
+			upToDate, err = localImageUpToDate(ctx, cli, img)
+			if err != nil {
+				return fmt.Errorf("unable to inspect image %s: %w\n", img.tags[0], err)
+			}
+			if !upToDate {
 				break
 			}
 		}
-		if jm.Error != nil {
-			return fmt.Errorf("unable to build image: %w\n", jm.Error)
-		} else {
-			var out strings.Builder
-			err := jm.Display(&out, false)
+		if upToDate {
+			fmt.Printf("Image %s is up to date\n", imageName)
+			return nil
+		}
+		if !isLocal {
+			// The registry is only a shortcut, so the image is built if it cannot be queried
+			var digest string
+			hash, err := contextHash(cwd, cfg, buildPlatforms(cfg)...)
 			if err != nil {
 				return err
 			}
-			res := out.String()
-			to := len(res) - 1
-			if to < 0 {
-				to = 0
+			username, password, err := registryCredentials(cfg)
+			if err == nil {
+				digest, err = remoteImageUpToDate(cfg, hash, &authn.Basic{Username: username, Password: password})
+			}
+			if err != nil {
+				logging.Logger.Info(fmt.Sprintf("Unable to check image %s in the registry: %s", imageName, err.Error()))
+			} else if digest != "" {
+				fmt.Printf("Image %s is up to date in the registry\n", imageName)
+				return nil
 			}
-			logging.Logger.Info(fmt.Sprintf("[Docker] %s", res[:to]))
 		}
 	}
-	fmt.Printf("Image has been built successfully with tag %s\n", imageName)
+	for _, img := range images {
+		err = buildPlatformImage(ctx, cli, cwd, cfg, img)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func buildPlatformImage(ctx context.Context, cli *docker.Client, cwd string, cfg *service.ProjectConfig, img platformImage) error {
+	contextDir, dockerfile, err := buildContextDir(cwd, cfg)
+	if err != nil {
+		return err
+	}
+	excludes, err := contextExcludes(cwd, contextDir, dockerfile)
+	if err != nil {
+		return err
+	}
+	dockerCtx, err := GetContext(contextDir, excludes)
+	if err != nil {
+		return fmt.Errorf("unable to create Docker context: %w\n", err)
+	}
+	buildArgs, err := renderBuildArgs(cfg)
+	if err != nil {
+		return err
+	}
+	labels := imageLabels(cwd, cfg)
+	labels[image.ContextHashLabel] = img.hash
+	logging.Logger.Info(fmt.Sprintf("Building an image %s...", img.tags[0]))
+	resp, err := cli.ImageBuild(ctx, dockerCtx, types.ImageBuildOptions{
+		Dockerfile: dockerfile,
+		Tags:       img.tags,
+		BuildArgs:  buildArgs,
+		Target:     cfg.GetBuild().Target,
+		Labels:     labels,
+		Platform:   img.platform,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to build image: %w\n", err)
+	}
+	defer resp.Body.Close()
+	err = progress.Render(resp.Body, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("unable to build image: %w\n", err)
+	}
+	fmt.Printf("Image has been built successfully with tag %s\n", img.tags[0])
+	return nil
+}
+
+var buildDockerfile string
+var buildContext string
+var buildArgs []string
+var buildTarget string
+var buildTags []string
+var forceBuild bool
+var buildPlatformsFlag []string
+var buildSBOM bool
+
 func init() {
 	rootCmd.AddCommand(buildCmd)
+
+	// Push takes the same build settings, since they identify the image by its context hash and tags
+	for _, c := range []*cobra.Command{buildCmd, pushCmd} {
+		c.Flags().StringVar(&buildDockerfile, "dockerfile", service.DefaultDockerfile, "Path of the Dockerfile relative to the project root")
+		c.Flags().StringVar(&buildContext, "context", service.DefaultBuildContext, "Build context directory relative to the project root")
+		c.Flags().StringArrayVar(&buildArgs, "build-arg", nil, "Build arg as KEY=VALUE, the value might refer to {{ .Name }} and {{ .Version }}")
+		c.Flags().StringVar(&buildTarget, "target", "", "Target stage of the Dockerfile")
+		c.Flags().StringArrayVar(&buildTags, "tag", nil, "Extra tag of the image, might refer to {{ .Name }} and {{ .Version }}")
+		c.Flags().StringSliceVar(&buildPlatformsFlag, "platform", nil, "Platforms to build the image for as os/arch[/variant], the native one if not set")
+	}
+	buildCmd.Flags().BoolVar(&buildSBOM, "sbom", false, "Write an SPDX SBOM of the image under .chill/sbom")
+	buildCmd.Flags().BoolVar(&forceBuild, "force", false, "Build the image even if its build context is unchanged")
 }
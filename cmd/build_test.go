@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/config"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path string, data string) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContextHashIgnoresRecordedDigest(t *testing.T) {
+	cwd := t.TempDir()
+	cfg := &service.ProjectConfig{
+		Name:           "demo",
+		Registry:       "registry.example.com/team",
+		CurrentVersion: &version.Version{Major: 1, Minor: 2},
+	}
+	s, err := config.ProcessConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SaveToFile(filepath.Join(cwd, config.LockConfigName), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(cwd, "Dockerfile"), "FROM scratch\nCOPY src /src\n")
+	writeTestFile(t, filepath.Join(cwd, "src", "main.go"), "package main\n")
+	writeTestFile(t, filepath.Join(cwd, ".git", "HEAD"), "ref: refs/heads/master\n")
+
+	before, err := contextHash(cwd, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = recordImageDigest(cwd, "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(cwd, ".git", "refs", "heads", "master"), "0123456789abcdef\n")
+	writeTestFile(t, filepath.Join(cwd, localStateDir, "sbom", "v1.2.0.spdx.json"), "{}\n")
+	after, err := contextHash(cwd, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before != after {
+		t.Fatal("recorded digest, commits or local state changed the context hash")
+	}
+
+	writeTestFile(t, filepath.Join(cwd, "src", "main.go"), "package main\n\nfunc main() {}\n")
+	changed, err := contextHash(cwd, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == after {
+		t.Fatal("source change did not change the context hash")
+	}
+}
+
+func TestPushTakesBuildFlags(t *testing.T) {
+	defer func() {
+		buildArgs, buildTags = nil, nil
+	}()
+	cwd := t.TempDir()
+	writeTestFile(t, filepath.Join(cwd, "image", "Dockerfile"), "FROM scratch\nARG MODE\n")
+	var hashes, tags []string
+	for _, c := range []*cobra.Command{buildCmd, pushCmd} {
+		buildArgs, buildTags = nil, nil
+		for name, value := range map[string]string{"build-arg": "MODE=release", "tag": "latest"} {
+			err := c.Flags().Set(name, value)
+			if err != nil {
+				t.Fatalf("%s: %v", c.Name(), err)
+			}
+		}
+		cfg := &service.ProjectConfig{
+			Name:           "demo",
+			Registry:       "registry.example.com/team",
+			CurrentVersion: &version.Version{Major: 1, Minor: 2},
+		}
+		err := applyBuildFlags(c, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, err := contextHash(cwd, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imageName, _ := cfg.GetBuildTag(false)
+		imageTags, err := imageTags(imageName, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+		tags = append(tags, strings.Join(imageTags, ","))
+	}
+	if hashes[0] != hashes[1] || tags[0] != tags[1] {
+		t.Fatalf("push computes a different image than build: %v %v", hashes, tags)
+	}
+	if tags[1] != "registry.example.com/team/demo:v1.2.0,registry.example.com/team/demo:latest" {
+		t.Fatalf("extra tag not pushed: %s", tags[1])
+	}
+}
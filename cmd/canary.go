@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	v12 "knative.dev/serving/pkg/client/clientset/versioned/typed/serving/v1"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const defaultReadyTimeout = 5 * time.Minute
+
+var canarySteps []int
+var canaryInterval time.Duration
+var canaryCheck string
+
+// validateCanarySteps makes sure the rollout ends with the version receiving all the traffic
+func validateCanarySteps(steps []int) error {
+	prev := 0
+	for _, p := range steps {
+		if p <= prev || p > 100 {
+			return fmt.Errorf("canary steps must strictly increase within (0, 100]")
+		}
+		prev = p
+	}
+	if prev != 100 {
+		return fmt.Errorf("the last canary step must be 100")
+	}
+	return nil
+}
+
+// trafficPercents returns the current traffic split of the service by version
+func trafficPercents(svc *servingv1.Service, major int) (map[version.Version]int64, error) {
+	res := map[version.Version]int64{}
+	for _, t := range svc.Status.Traffic {
+		if t.Tag == "" || t.Percent == nil {
+			continue
+		}
+		v, err := cluster.ParseRevisionTag(t.Tag, major)
+		if err != nil {
+			return nil, err
+		}
+		res[*v] += *t.Percent
+	}
+	return res, nil
+}
+
+// checkCanary verifies that the canary revision is still ready and that the user check passes
+func checkCanary(knative v12.ServingV1Interface, name string, cfg *service.ProjectConfig, percent int) error {
+	svc, err := knative.Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	if !svc.IsReady() {
+		return fmt.Errorf("service %s is not ready anymore", name)
+	}
+	tag := cluster.RevisionTag(*cfg.CurrentVersion)
+	var url string
+	for _, t := range svc.Status.Traffic {
+		if t.Tag != tag {
+			continue
+		}
+		revision, err := knative.Revisions(KubeNamespace).Get(context.TODO(), t.RevisionName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if !revision.IsReady() {
+			return fmt.Errorf("revision %s is not ready anymore", revision.Name)
+		}
+		if t.URL != nil {
+			url = t.URL.String()
+		}
+	}
+	if canaryCheck == "" {
+		return nil
+	}
+	q := exec.Command("sh", "-c", canaryCheck)
+	q.Env = append(os.Environ(),
+		"CHILL_CANARY_VERSION="+cfg.CurrentVersion.String(),
+		"CHILL_CANARY_PERCENT="+strconv.Itoa(percent),
+		"CHILL_CANARY_URL="+url,
+	)
+	q.Stdout = os.Stdout
+	q.Stderr = os.Stderr
+	if err := q.Run(); err != nil {
+		return fmt.Errorf("canary check failed: %w", err)
+	}
+	return nil
+}
+
+// setTrafficPercents rewrites the route of the live service only
+func setTrafficPercents(knative v12.ServingV1Interface, name string, major int, percents map[version.Version]int64) error {
+	svc, err := knative.Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	trafficList, err := cluster.RetargetTraffic(svc.Status.Traffic, major, percents)
+	if err != nil {
+		return err
+	}
+	svc.Spec.RouteSpec.Traffic = trafficList
+	_, err = knative.Services(KubeNamespace).Update(context.TODO(), svc, metav1.UpdateOptions{})
+	return err
+}
+
+// restoreTrafficSplit sets the split read before the rollout; the cause of the failure is kept
+// for callers inspecting it even if the split cannot be restored
+func restoreTrafficSplit(
+	knative v12.ServingV1Interface,
+	name string,
+	major int,
+	previous map[version.Version]int64,
+	cause error,
+) error {
+	println("Canary rollout failed, restoring the previous traffic split")
+	restoreErr := setTrafficPercents(knative, name, major, previous)
+	if restoreErr != nil {
+		return errors.Join(cause, fmt.Errorf("unable to restore the traffic split: %w", restoreErr))
+	}
+	return cause
+}
+
+// runCanary rolls the built service out step by step, restoring the previous split on any failure;
+// it must be called holding the service lock
+func runCanary(
+	cfg *service.ProjectConfig,
+	clusterManager cluster.ClusterManager,
+	knative v12.ServingV1Interface,
+	name string,
+	existingService *servingv1.Service,
+	svc *servingv1.Service,
+	steps []int,
+) error {
+	ver := *cfg.CurrentVersion
+	major := ver.GetMajor()
+	previous, err := trafficPercents(existingService, major)
+	if err != nil {
+		return err
+	}
+	percents, err := cluster.ScaleTraffic(previous, ver, int64(steps[0]))
+	if err != nil {
+		return err
+	}
+	svc.Spec.RouteSpec.Traffic, err = buildProductionTrafficList(cfg, existingService, percents)
+	if err != nil {
+		return err
+	}
+	svc.SetResourceVersion(existingService.GetResourceVersion())
+	svc.ObjectMeta = existingService.ObjectMeta
+	_, err = knative.Services(KubeNamespace).Update(context.TODO(), svc, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("Knative server error while updating: %w\n", err)
+	}
+
+	timeout := waitTimeout
+	if timeout == 0 {
+		timeout = defaultReadyTimeout
+	}
+	restore := func(cause error) error {
+		return restoreTrafficSplit(knative, name, major, previous, cause)
+	}
+
+	for i, step := range steps {
+		if i > 0 {
+			percents, err = cluster.ScaleTraffic(previous, ver, int64(step))
+			if err != nil {
+				return restore(err)
+			}
+			err = setTrafficPercents(knative, name, major, percents)
+			if err != nil {
+				return restore(err)
+			}
+		}
+		err = waitForService(clusterManager, name, timeout)
+		if err != nil {
+			return restore(err)
+		}
+		fmt.Printf("Version %s receives %d%% of traffic\n", ver.String(), step)
+
+		// The final step is checked as well, so the rollout only succeeds once the full split is healthy
+		logging.Logger.Info(fmt.Sprintf("Waiting %s before checking the step...", canaryInterval.String()))
+		time.Sleep(canaryInterval)
+		err = checkCanary(knative, name, cfg, step)
+		if err != nil {
+			return restore(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"github.com/chill-cloud/chill-cli/pkg/util"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/client/clientset/versioned/fake"
+	"strings"
+	"testing"
+)
+
+func TestValidateCanarySteps(t *testing.T) {
+	for _, tc := range []struct {
+		steps []int
+		valid bool
+	}{
+		{steps: []int{5, 25, 50, 100}, valid: true},
+		{steps: []int{100}, valid: true},
+		{steps: []int{5, 5, 100}},
+		{steps: []int{50, 25, 100}},
+		{steps: []int{0, 100}},
+		{steps: []int{-5, 100}},
+		{steps: []int{50, 150}},
+		{steps: []int{5, 25, 50}},
+	} {
+		err := validateCanarySteps(tc.steps)
+		if tc.valid && err != nil {
+			t.Fatalf("%v rejected: %v", tc.steps, err)
+		}
+		if !tc.valid && err == nil {
+			t.Fatalf("%v accepted", tc.steps)
+		}
+	}
+}
+
+func canaryTestService(name string) *servingv1.Service {
+	svc := &servingv1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: KubeNamespace}}
+	svc.Status.Traffic = []servingv1.TrafficTarget{
+		{RevisionName: name + "-a", Tag: "v1-0", Percent: util.Int64Ptr(70)},
+		{RevisionName: name + "-b", Tag: "v2-0", Percent: util.Int64Ptr(30)},
+		{RevisionName: name + "-c", Tag: "v3-0", Percent: util.Int64Ptr(0)},
+		{RevisionName: name + "-c", LatestRevision: util.BoolPtr(true), Percent: util.Int64Ptr(0)},
+	}
+	return svc
+}
+
+func TestCanaryRestoresPreviousSplit(t *testing.T) {
+	svc := canaryTestService("demo-v1")
+	previous, err := trafficPercents(svc, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1, v2, v3 := version.Version{Major: 1, Minor: 1}, version.Version{Major: 1, Minor: 2}, version.Version{Major: 1, Minor: 3}
+	if len(previous) != 3 || previous[v1] != 70 || previous[v2] != 30 || previous[v3] != 0 {
+		t.Fatalf("wrong split read: %v", previous)
+	}
+
+	// The failed step has moved the traffic, restoring sets the split read before the rollout
+	knative := fake.NewSimpleClientset(svc).ServingV1()
+	err = setTrafficPercents(knative, svc.Name, 1, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored, err := knative.Services(KubeNamespace).Get(context.TODO(), svc.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	percents := map[string]int64{}
+	for _, target := range restored.Spec.Traffic {
+		if target.LatestRevision == nil || *target.LatestRevision {
+			t.Fatalf("traffic of %s not pinned to its revision", target.Tag)
+		}
+		percents[target.RevisionName] = *target.Percent
+	}
+	if len(percents) != 3 || percents["demo-v1-a"] != 70 || percents["demo-v1-b"] != 30 || percents["demo-v1-c"] != 0 {
+		t.Fatalf("wrong split restored: %v", percents)
+	}
+}
+
+func TestCanaryRestoreKeepsCause(t *testing.T) {
+	svc := canaryTestService("demo-v1")
+	previous, err := trafficPercents(svc, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cause := errors.New("revision is not ready")
+	knative := fake.NewSimpleClientset(svc).ServingV1()
+	err = restoreTrafficSplit(knative, svc.Name, 1, previous, cause)
+	if err != cause {
+		t.Fatalf("restored rollout failed with %v", err)
+	}
+	// The service is gone, so the split cannot be restored, yet the cause is still reported
+	err = restoreTrafficSplit(knative, "missing-v1", 1, previous, cause)
+	if !errors.Is(err, cause) || !strings.Contains(err.Error(), "unable to restore") {
+		t.Fatalf("failed restore reported as %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service/naming"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	v12 "knative.dev/serving/pkg/client/clientset/versioned/typed/serving/v1"
+	"strconv"
+	"strings"
+)
+
+// dependent is a live revision of another service referring to the service
+type dependent struct {
+	Name    string
+	Version string
+	Major   int
+	// Revision is nil when the dependent follows the whole major deployment
+	Revision *version.Version
+}
+
+func (d dependent) String() string {
+	return fmt.Sprintf("%s %s", d.Name, d.Version)
+}
+
+// containerEnv returns the value of the variable set for any of the containers
+func containerEnv(containers []v1.Container, key string) string {
+	for _, c := range containers {
+		for _, e := range c.Env {
+			if e.Name == key {
+				return e.Value
+			}
+		}
+	}
+	return ""
+}
+
+func revisionEnv(revision *servingv1.Revision, key string) string {
+	return containerEnv(revision.Spec.Containers, key)
+}
+
+// revisionVersion recovers the version of the revision deployed by Chill, nil if it is unknown
+func revisionVersion(revision *servingv1.Revision) *version.Version {
+	v, err := version.ParseFromString(revisionEnv(revision, "CHILL_SELF_VERSION"))
+	if err != nil {
+		return nil
+	}
+	return v
+}
+
+// parseDependencyHost is the inverse of GetInternalServiceHost
+func parseDependencyHost(clusterManager cluster.ClusterManager, name string, host string) (int, *version.Version, error) {
+	firstPart := strings.Split(host, ".")[0]
+	depName, v, err := clusterManager.GetServiceAndVersion(firstPart)
+	if err == nil && depName == name {
+		return v.GetMajor(), v, nil
+	}
+	prefix := name + "-v"
+	if strings.HasPrefix(firstPart, prefix) {
+		major, err := strconv.Atoi(strings.TrimPrefix(firstPart, prefix))
+		if err == nil {
+			return major, nil, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("unable to recognize host %s of service %s", host, name)
+}
+
+// containerDependent recognizes another service referring to the service through the CHILL_SERVICE_*
+// variable of its containers; nil if the containers belong to the service itself or do not refer to it
+func containerDependent(clusterManager cluster.ClusterManager, name string, containers []v1.Container) (*dependent, error) {
+	self := containerEnv(containers, "CHILL_SELF_NAME")
+	if self == name {
+		return nil, nil
+	}
+	host := containerEnv(containers, naming.NameToEnv(name))
+	if host == "" {
+		return nil, nil
+	}
+	major, v, err := parseDependencyHost(clusterManager, name, host)
+	if err != nil {
+		return nil, err
+	}
+	return &dependent{
+		Name:     self,
+		Version:  containerEnv(containers, "CHILL_SELF_VERSION"),
+		Major:    major,
+		Revision: v,
+	}, nil
+}
+
+// findDependents lists revisions of other services which receive traffic or are reachable
+// by their tags and refer to the service through the CHILL_SERVICE_* variable
+func findDependents(
+	clusterManager cluster.ClusterManager,
+	knative v12.ServingV1Interface,
+	name string,
+) ([]dependent, error) {
+	services, err := knative.Services(KubeNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %w", err)
+	}
+	live := map[string]bool{}
+	for _, s := range services.Items {
+		for _, t := range s.Status.Traffic {
+			if t.RevisionName != "" {
+				live[t.RevisionName] = true
+			}
+		}
+	}
+	revisions, err := knative.Revisions(KubeNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list revisions: %w", err)
+	}
+
+	var res []dependent
+	for i := range revisions.Items {
+		revision := &revisions.Items[i]
+		if !live[revision.Name] {
+			continue
+		}
+		d, err := containerDependent(clusterManager, name, revision.Spec.Containers)
+		if err != nil {
+			return nil, err
+		}
+		if d != nil {
+			res = append(res, *d)
+		}
+	}
+	return res, nil
+}
+
+// deleteConfigMap removes the plain configuration of the revision if there is one
+func deleteConfigMap(clusterManager cluster.ClusterManager, configMapName string) error {
+	k8sClient, err := clusterManager.GetKubernetesClient()
+	if err != nil {
+		return err
+	}
+	return deleteConfigMapWith(k8sClient, configMapName)
+}
+
+// deleteConfigMapWith removes the plain configuration through the client already built
+func deleteConfigMapWith(k8sClient kubernetes.Interface, configMapName string) error {
+	err := k8sClient.CoreV1().ConfigMaps(KubeNamespace).Delete(context.TODO(), configMapName, metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("unable to delete config map %s: %w", configMapName, err)
+	}
+	return nil
+}
+
+// listConfigMaps returns names of plain configurations deployed for the major version
+func listConfigMaps(clusterManager cluster.ClusterManager, name string, major int) ([]string, error) {
+	k8sClient, err := clusterManager.GetKubernetesClient()
+	if err != nil {
+		return nil, err
+	}
+	configMaps, err := k8sClient.CoreV1().ConfigMaps(KubeNamespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list config maps: %w", err)
+	}
+	var res []string
+	for _, cm := range configMaps.Items {
+		if !strings.HasPrefix(cm.Name, "chill-config-") {
+			continue
+		}
+		cmName, v, err := clusterManager.GetServiceAndVersion(strings.TrimPrefix(cm.Name, "chill-config-"))
+		if err != nil || cmName != name || v.GetMajor() != major {
+			continue
+		}
+		res = append(res, cm.Name)
+	}
+	return res, nil
+}
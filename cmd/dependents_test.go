@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"context"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service/naming"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"knative.dev/serving/pkg/client/clientset/versioned/fake"
+	"sort"
+	"testing"
+)
+
+func TestParseDependencyHost(t *testing.T) {
+	clusterManager := cluster.NewOffline("staging")
+	for _, tc := range []struct {
+		host     string
+		major    int
+		revision *version.Version
+		valid    bool
+	}{
+		{host: "v2-0-demo-v1.staging.svc.cluster.local", major: 1, revision: &version.Version{Major: 1, Minor: 2}, valid: true},
+		{host: "v0-3-demo-v2.staging.svc.cluster.local", major: 2, revision: &version.Version{Major: 2, Patch: 3}, valid: true},
+		{host: "demo-v1.staging.svc.cluster.local", major: 1, valid: true},
+		{host: "demo-v3.staging.svc.cluster.local", major: 3, valid: true},
+		// Hosts of other services
+		{host: "v2-0-other-v1.staging.svc.cluster.local"},
+		{host: "other-v1.staging.svc.cluster.local"},
+		{host: "v2-0-demo-extra-v1.staging.svc.cluster.local"},
+		{host: "demo-extra-v1.staging.svc.cluster.local"},
+		// Malformed values
+		{host: ""},
+		{host: "demo"},
+		{host: "demo-vx.staging.svc.cluster.local"},
+		{host: "v2-x-demo-v1.staging.svc.cluster.local"},
+	} {
+		major, revision, err := parseDependencyHost(clusterManager, "demo", tc.host)
+		if !tc.valid {
+			if err == nil {
+				t.Fatalf("host %q recognized", tc.host)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("host %q not recognized: %v", tc.host, err)
+		}
+		if major != tc.major {
+			t.Fatalf("host %q recognized as major %d", tc.host, major)
+		}
+		if (revision == nil) != (tc.revision == nil) || revision != nil && revision.Compare(*tc.revision) != 0 {
+			t.Fatalf("host %q recognized as revision %v", tc.host, revision)
+		}
+	}
+}
+
+func dependentsTestRevision(name string, env map[string]string) *servingv1.Revision {
+	var vars []v1.EnvVar
+	for k, v := range env {
+		vars = append(vars, v1.EnvVar{Name: k, Value: v})
+	}
+	revision := &servingv1.Revision{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: KubeNamespace}}
+	revision.Spec.Containers = []v1.Container{{Env: vars}}
+	return revision
+}
+
+func TestFindDependents(t *testing.T) {
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	key := naming.NameToEnv("demo")
+	svc := &servingv1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web-v1", Namespace: KubeNamespace}}
+	svc.Status.Traffic = []servingv1.TrafficTarget{
+		{RevisionName: "web-a"},
+		{RevisionName: "web-b"},
+		{RevisionName: "web-c"},
+		{RevisionName: "demo-a"},
+	}
+	revisions := []*servingv1.Revision{
+		dependentsTestRevision("web-a", map[string]string{
+			"CHILL_SELF_NAME": "web", "CHILL_SELF_VERSION": "v1.0.0", key: "v2-0-demo-v1.default.svc.cluster.local",
+		}),
+		dependentsTestRevision("web-b", map[string]string{
+			"CHILL_SELF_NAME": "web", "CHILL_SELF_VERSION": "v1.1.0", key: "demo-v2.default.svc.cluster.local",
+		}),
+		// Revisions not referring to the service
+		dependentsTestRevision("web-c", map[string]string{
+			"CHILL_SELF_NAME": "web", "CHILL_SELF_VERSION": "v1.2.0", naming.NameToEnv("other"): "other-v1.default.svc.cluster.local",
+		}),
+		dependentsTestRevision("demo-a", map[string]string{
+			"CHILL_SELF_NAME": "demo", "CHILL_SELF_VERSION": "v1.2.0", key: "demo-v1.default.svc.cluster.local",
+		}),
+		// Revisions neither receiving traffic nor tagged are not live
+		dependentsTestRevision("web-old", map[string]string{
+			"CHILL_SELF_NAME": "web", "CHILL_SELF_VERSION": "v0.9.0", key: "demo-v1.default.svc.cluster.local",
+		}),
+	}
+	client := fake.NewSimpleClientset(svc)
+	for _, r := range revisions {
+		err := client.Tracker().Add(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	res, err := findDependents(clusterManager, client.ServingV1(), "demo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Version < res[j].Version
+	})
+	if len(res) != 2 {
+		t.Fatalf("wrong dependents found: %v", res)
+	}
+	if res[0].Name != "web" || res[0].Major != 1 || res[0].Revision == nil || res[0].Revision.GetMinor() != 2 {
+		t.Fatalf("wrong dependent found: %+v", res[0])
+	}
+	if res[1].Version != "v1.1.0" || res[1].Major != 2 || res[1].Revision != nil {
+		t.Fatalf("wrong dependent found: %+v", res[1])
+	}
+
+	// A value which cannot be recognized might refer to the service, so the guard fails
+	err = client.Tracker().Add(dependentsTestRevision("web-d", map[string]string{
+		"CHILL_SELF_NAME": "web", "CHILL_SELF_VERSION": "v1.3.0", key: "localhost:8080",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.Status.Traffic = append(svc.Status.Traffic, servingv1.TrafficTarget{RevisionName: "web-d"})
+	_, err = client.ServingV1().Services(KubeNamespace).UpdateStatus(context.TODO(), svc, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = findDependents(clusterManager, client.ServingV1(), "demo")
+	if err == nil {
+		t.Fatal("malformed host of a live dependent ignored")
+	}
+}
@@ -2,31 +2,39 @@ package cmd
 
 import (
 	"context"
+	"encoding/json"
 	errors2 "errors"
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cache"
 	"github.com/chill-cloud/chill-cli/pkg/cluster"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	cwd2 "github.com/chill-cloud/chill-cli/pkg/cwd"
+	"github.com/chill-cloud/chill-cli/pkg/integrations/server"
 	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/service"
 	"github.com/chill-cloud/chill-cli/pkg/service/naming"
 	util "github.com/chill-cloud/chill-cli/pkg/util"
 	"github.com/chill-cloud/chill-cli/pkg/version"
 	"github.com/chill-cloud/chill-cli/pkg/version/set"
+	"github.com/pmezard/go-difflib/difflib"
 	"github.com/spf13/cobra"
-	"github.com/werf/lockgate"
-	"github.com/werf/lockgate/pkg/distributed_locker"
-	"github.com/werf/werf/pkg/kubeutils"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/serving/pkg/apis/autoscaling"
 	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	v12 "knative.dev/serving/pkg/client/clientset/versioned/typed/serving/v1"
+	"os"
+	"reflect"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
 func RunDeploy(cmd *cobra.Command, args []string) error {
-	cwd, err := cwd2.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
@@ -35,20 +43,46 @@ func RunDeploy(cmd *cobra.Command, args []string) error {
 	if err != nil {
 		return err
 	}
-
-	s, err := cache.NewLocalSourceOfTruth(cwd)
+	if cfg == nil {
+		return fmt.Errorf("no project config found")
+	}
+	err = cfg.ApplyEnvironment(Environment)
 	if err != nil {
 		return err
 	}
 
-	clean, err := s.IsClean()
+	if _, pinned := cfg.GetImageRef(ForceLocal); !pinned {
+		if _, isLocal := cfg.GetBuildTag(ForceLocal); !isLocal {
+			fmt.Fprintln(os.Stderr, "WARNING! No image digest recorded for this version, deploying by the mutable tag; push the image to pin it")
+		}
+	}
 
+	// Rendered manifests are deployed by other tools, so they must refer to a signed image as well
+	if requireSignature {
+		err = verifyImageSignature(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	if dryRun {
+		if Backend != backendKnative {
+			return fmt.Errorf("dry run is only supported by the %s backend", backendKnative)
+		}
+		if withDependencies {
+			return fmt.Errorf("dependencies cannot be deployed in dry run mode")
+		}
+		return runDeployDryRun(cfg)
+	}
+
+	s, err := cache.NewLocalSourceOfTruth(cwd)
 	if err != nil {
 		return err
 	}
 
-	if clean != nil {
-		return fmt.Errorf("uncommitted or untracked changes detected; commit or stash them")
+	err = checkClean(cwd, s)
+	if err != nil {
+		return err
 	}
 
 	if !forceFrozen {
@@ -63,245 +97,667 @@ func RunDeploy(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeNamespace)
+	err = checkPinnedImage(cfg)
 	if err != nil {
-		return fmt.Errorf("unable to build cluster client")
+		return err
 	}
-	knative, err := clusterManager.GetKnative()
-	if err != nil {
-		return fmt.Errorf("unable to build Knative client")
+
+	if len(canarySteps) > 0 {
+		if Backend != backendKnative {
+			return fmt.Errorf("canary rollout is only supported by the %s backend", backendKnative)
+		}
+		if !version.IsProduction(*cfg.CurrentVersion) {
+			return fmt.Errorf("only production versions might be rolled out gradually")
+		}
+		if err := validateCanarySteps(canarySteps); err != nil {
+			return err
+		}
 	}
-	ver := cfg.CurrentVersion
-	name := fmt.Sprintf("%s-v%d", cfg.Name, ver.GetMajor())
-	imageName, _ := cfg.GetBuildTag(ForceLocal)
 
-	k8sClient, err := clusterManager.GetKubernetesClient()
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return fmt.Errorf("unable to build cluster client")
+	}
+	backend, err := newDeployBackend(clusterManager)
 	if err != nil {
 		return err
 	}
+	if withDependencies {
+		err = deployDependencies(cfg, clusterManager, backend)
+		if err != nil {
+			return err
+		}
+	}
+
+	return deployService(cfg, clusterManager, backend, canarySteps, waitTimeout)
+}
 
-	configMapName := fmt.Sprintf("chill-lock-%s", name)
+// servicePort is the port every Chill service listens to
+const servicePort int32 = 80
 
-	_, err = kubeutils.GetOrCreateConfigMapWithNamespaceIfNotExists(k8sClient, KubeNamespace, configMapName)
+// getKnativeService fetches the service, returning false if it has not been created yet
+func getKnativeService(knative v12.ServingV1Interface, name string) (*servingv1.Service, bool, error) {
+	existingService, err := knative.Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
 	if err != nil {
-		return err
+		var typedErr *errors.StatusError
+		if errors2.As(err, &typedErr) && typedErr.Status().Reason == metav1.StatusReasonNotFound {
+			logging.Logger.Info("Service not created yet")
+			return &servingv1.Service{}, false, nil
+		}
+		return nil, false, err
+	}
+	logging.Logger.Info(fmt.Sprintf("Service %s present, version: %s", existingService.Name, existingService.ResourceVersion))
+	return existingService, true, nil
+}
+
+// buildProductionTrafficList routes traffic to the latest revision and the live ones according to percents
+func buildProductionTrafficList(
+	cfg *service.ProjectConfig,
+	existingService *servingv1.Service,
+	percents map[version.Version]int64,
+) ([]servingv1.TrafficTarget, error) {
+	trafficList := []servingv1.TrafficTarget{
+		{
+			LatestRevision: util.BoolPtr(true),
+			Percent:        util.Int64Ptr(percents[*cfg.CurrentVersion]),
+			Tag:            cluster.RevisionTag(*cfg.CurrentVersion),
+		},
+	}
+	var versions []version.Version
+	for _, t := range existingService.Status.RouteStatusFields.Traffic {
+		v, err := cluster.ParseRevisionTag(t.Tag, cfg.CurrentVersion.GetMajor())
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, *v)
+		trafficList = append(trafficList, servingv1.TrafficTarget{
+			RevisionName:      t.RevisionName,
+			Percent:           util.Int64Ptr(percents[*v]),
+			ConfigurationName: t.ConfigurationName,
+			Tag:               t.Tag,
+		})
+	}
+	latest := set.ArrayVersionSet(versions).GetLatestProductionVersion()
+	if !latest.MayBeNext(cfg.CurrentVersion) {
+		println("Wrong deploying order; retry might help")
+		return nil, errRetryLocked
 	}
+	return trafficList, nil
+}
 
-	lockerClient, err := clusterManager.GetLockerClient()
+// buildTrafficList computes the route of the service with the current version deployed
+func buildTrafficList(cfg *service.ProjectConfig, existingService *servingv1.Service) ([]servingv1.TrafficTarget, error) {
+	if version.IsProduction(*cfg.CurrentVersion) {
+		targets, err := cfg.GetTrafficTargets()
+		if err != nil {
+			return nil, err
+		}
+		percents := map[version.Version]int64{}
+		for v, p := range targets {
+			percents[v] = int64(p)
+		}
+		return buildProductionTrafficList(cfg, existingService, percents)
+	}
+	return buildDevelopmentTrafficList(cfg, existingService), nil
+}
 
+// buildDevelopmentTrafficList tags the latest revision without routing traffic to it,
+// the previous revision of the same version is replaced
+func buildDevelopmentTrafficList(cfg *service.ProjectConfig, existingService *servingv1.Service) []servingv1.TrafficTarget {
+	tag := cluster.RevisionTag(*cfg.CurrentVersion)
+	trafficList := []servingv1.TrafficTarget{
+		{
+			LatestRevision: util.BoolPtr(true),
+			Percent:        util.Int64Ptr(0),
+			Tag:            tag,
+		},
+	}
+	for _, t := range existingService.Status.RouteStatusFields.Traffic {
+		if t.Tag == tag {
+			continue
+		}
+		trafficList = append(trafficList, servingv1.TrafficTarget{
+			RevisionName:      t.RevisionName,
+			Percent:           t.Percent,
+			ConfigurationName: t.ConfigurationName,
+			Tag:               t.Tag,
+		})
+	}
+	return trafficList
+}
+
+func configMapName(name string, v version.Version, clusterManager cluster.ClusterManager) string {
+	return fmt.Sprintf("chill-config-%s", clusterManager.GetRevisionPath(name, v))
+}
+
+// buildConfigMap computes the versioned plain configuration of the service, nil if there is none
+func buildConfigMap(cfg *service.ProjectConfig, clusterManager cluster.ClusterManager) (*v1.ConfigMap, error) {
+	values, err := cfg.GetConfig(Environment)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	return &v1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "v1",
+			Kind:       "ConfigMap",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: configMapName(cfg.Name, *cfg.CurrentVersion, clusterManager),
+		},
+		Data: values,
+	}, nil
+}
+
+// applyConfigMap creates the config map or replaces its data
+func applyConfigMap(clusterManager cluster.ClusterManager, configMap *v1.ConfigMap) error {
+	k8sClient, err := clusterManager.GetKubernetesClient()
 	if err != nil {
 		return err
 	}
+	configMaps := k8sClient.CoreV1().ConfigMaps(KubeNamespace)
+	existing, err := configMaps.Get(context.TODO(), configMap.Name, metav1.GetOptions{})
+	if err != nil {
+		var typedErr *errors.StatusError
+		if errors2.As(err, &typedErr) && typedErr.Status().Reason == metav1.StatusReasonNotFound {
+			_, err = configMaps.Create(context.TODO(), configMap, metav1.CreateOptions{})
+		}
+		return err
+	}
+	existing.Data = configMap.Data
+	_, err = configMaps.Update(context.TODO(), existing, metav1.UpdateOptions{})
+	return err
+}
 
-	locker := distributed_locker.NewKubernetesLocker(
-		lockerClient, schema.GroupVersionResource{
-			Group:    "",
-			Version:  "v1",
-			Resource: "configmaps",
+// buildRevisionTemplate computes the revision of the current version
+func buildRevisionTemplate(cfg *service.ProjectConfig, clusterManager cluster.ClusterManager) (*servingv1.RevisionTemplateSpec, error) {
+	imageName, pinned := cfg.GetImageRef(ForceLocal)
+	// Tags are mutable, so they are pulled every time
+	pullPolicy := v1.PullAlways
+	if pinned {
+		pullPolicy = v1.PullIfNotPresent
+	}
+	// Local images may have never been pushed anywhere, so the loader knows whether they can be pulled
+	if _, isLocal := cfg.GetBuildTag(ForceLocal); isLocal {
+		loader, err := newLocalLoader()
+		if err != nil {
+			return nil, err
+		}
+		pullPolicy = loader.PullPolicy()
+	}
+	envList := []v1.EnvVar{
+		{
+			Name:  "CHILL_SELF_NAME",
+			Value: cfg.Name,
 		},
-		configMapName, KubeNamespace,
-	)
-
-	for i := 0; i < attemptsLimit; i++ {
-		locked, h, err := locker.Acquire("lock", lockgate.AcquireOptions{Shared: false, Timeout: time.Duration(lockTimeout) * time.Second})
+		{
+			Name:  "CHILL_SELF_VERSION",
+			Value: cfg.CurrentVersion.String(),
+		},
+	}
+	for dep := range cfg.Dependencies {
+		specificVersion := dep.GetSpecificVersion()
+		if specificVersion == nil {
+			return nil, fmt.Errorf("specific version must be set for service %s", dep.GetName())
+		}
+		host, err := clusterManager.GetInternalServiceHost(dep.GetName(), *specificVersion, dep.GetVersion())
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if locked {
-			defer func() {
-				err := locker.Release(h)
-				if err != nil {
-					panic(err)
-				}
-			}()
-			existingService, err := knative.Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
-			created := true
-			if err != nil {
-				var typedErr *errors.StatusError
-				switch {
-				case errors2.As(err, &typedErr):
-					if typedErr.Status().Reason == metav1.StatusReasonNotFound {
-						logging.Logger.Info("Service not created yet")
-						created = false
-					}
-				default:
-					return err
-				}
-			} else {
-				logging.Logger.Info(fmt.Sprintf("Service %s present, version: %s", existingService.Name, existingService.ResourceVersion))
-			}
-
-			var trafficList []servingv1.TrafficTarget
-			if version.IsProduction(*cfg.CurrentVersion) {
-				targets, err := cfg.GetTrafficTargets()
-				if err != nil {
-					return err
-				}
-				trafficList = []servingv1.TrafficTarget{
-					{
-						LatestRevision: util.BoolPtr(true),
-						Percent:        util.Int64Ptr(int64(targets[*cfg.CurrentVersion])),
-						Tag:            fmt.Sprintf("v%d-%d", ver.GetMinor(), ver.GetPatch()),
-					},
-				}
-				var versions []version.Version
-				for _, t := range existingService.Status.RouteStatusFields.Traffic {
-					var minor, patch int
-					_, err := fmt.Sscanf(t.Tag, "v%d-%d", &minor, &patch)
-					if err != nil {
-						return err
-					}
-					versions = append(versions, version.Version{Major: cfg.CurrentVersion.GetMajor(), Minor: minor, Patch: patch})
-					trafficList = append(trafficList, servingv1.TrafficTarget{
-						RevisionName: t.RevisionName,
-						Percent: util.Int64Ptr(int64(targets[version.Version{
-							Major: cfg.CurrentVersion.GetMajor(),
-							Minor: minor,
-							Patch: patch,
-						}])),
-						ConfigurationName: t.ConfigurationName,
-						Tag:               t.Tag,
-					})
-				}
-				latest := set.ArrayVersionSet(versions).GetLatestProductionVersion()
-				if !latest.MayBeNext(cfg.CurrentVersion) {
-					println("Wrong deploying order; retry might help")
-					continue
-				}
-			} else {
-				trafficList = []servingv1.TrafficTarget{
-					{
-						LatestRevision: util.BoolPtr(true),
-						Percent:        util.Int64Ptr(0),
-						Tag:            fmt.Sprintf("v%d-%d", ver.GetMinor(), ver.GetPatch()),
-					},
-				}
-				for _, t := range existingService.Status.RouteStatusFields.Traffic {
-					trafficList = append(trafficList, servingv1.TrafficTarget{
-						RevisionName:      t.RevisionName,
-						Percent:           t.Percent,
-						ConfigurationName: t.ConfigurationName,
-						Tag:               t.Tag,
-					})
-				}
-			}
-			envList := []v1.EnvVar{
-				{
-					Name:  "CHILL_SELF_NAME",
-					Value: cfg.Name,
+		envList = append(envList, v1.EnvVar{
+			Name:  naming.NameToEnv(dep.GetName()),
+			Value: host,
+		})
+	}
+	var volumes []v1.Volume
+	var volumeMounts []v1.VolumeMount
+	for _, s := range cfg.Secrets {
+		envList = append(envList, v1.EnvVar{
+			Name: naming.SecretToEnv(s),
+			ValueFrom: &v1.EnvVarSource{
+				SecretKeyRef: &v1.SecretKeySelector{
+					LocalObjectReference: v1.LocalObjectReference{Name: s},
+					Key:                  cluster.ChillSecretKey,
 				},
-				{
-					Name:  "CHILL_SELF_VERSION",
-					Value: cfg.CurrentVersion.String(),
+			},
+		})
+		volumes = append(volumes, v1.Volume{
+			Name: fmt.Sprintf("chill-secret-mount-%s", s),
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{
+					SecretName: s,
 				},
-			}
-			for dep := range cfg.Dependencies {
-				specificVersion := dep.GetSpecificVersion()
-				if specificVersion == nil {
-					return fmt.Errorf("specific version must be set for service %s", dep.GetName())
-				}
-				host, err := clusterManager.GetInternalServiceHost(dep.GetName(), *specificVersion, dep.GetVersion())
-				if err != nil {
-					return err
-				}
-				envList = append(envList, v1.EnvVar{
-					Name:  naming.NameToEnv(dep.GetName()),
-					Value: host,
-				})
-			}
-			var volumes []v1.Volume
-			var volumeMounts []v1.VolumeMount
-			for _, s := range cfg.Secrets {
-				envList = append(envList, v1.EnvVar{
-					Name: naming.SecretToEnv(s),
-					ValueFrom: &v1.EnvVarSource{
-						SecretKeyRef: &v1.SecretKeySelector{
-							LocalObjectReference: v1.LocalObjectReference{Name: s},
-							Key:                  cluster.ChillSecretKey,
-						},
-					},
-				})
-				volumes = append(volumes, v1.Volume{
-					Name: fmt.Sprintf("chill-secret-mount-%s", s),
-					VolumeSource: v1.VolumeSource{
-						Secret: &v1.SecretVolumeSource{
-							SecretName: s,
-						},
-					},
-				})
-				volumeMounts = append(volumeMounts, v1.VolumeMount{
-					Name:      fmt.Sprintf("chill-secret-mount-%s", s),
-					MountPath: naming.SecretToMountPath(s),
-				})
-			}
-			service := servingv1.Service{
-				ObjectMeta: existingService.ObjectMeta,
-				Spec: servingv1.ServiceSpec{
-					RouteSpec: servingv1.RouteSpec{
-						Traffic: trafficList,
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      fmt.Sprintf("chill-secret-mount-%s", s),
+			MountPath: naming.SecretToMountPath(s),
+		})
+	}
+	configMap, err := buildConfigMap(cfg, clusterManager)
+	if err != nil {
+		return nil, err
+	}
+	if configMap != nil {
+		var keys []string
+		for k := range configMap.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			envList = append(envList, v1.EnvVar{
+				Name: k,
+				ValueFrom: &v1.EnvVarSource{
+					ConfigMapKeyRef: &v1.ConfigMapKeySelector{
+						LocalObjectReference: v1.LocalObjectReference{Name: configMap.Name},
+						Key:                  k,
 					},
-					ConfigurationSpec: servingv1.ConfigurationSpec{
-						Template: servingv1.RevisionTemplateSpec{
-							Spec: servingv1.RevisionSpec{
-								PodSpec: v1.PodSpec{
-									Volumes: volumes,
-									Containers: []v1.Container{
-										{
-											Image:           imageName,
-											ImagePullPolicy: v1.PullAlways,
-											Ports: []v1.ContainerPort{
-												{
-													Name:          "h2c",
-													Protocol:      v1.ProtocolTCP,
-													ContainerPort: 80,
-												},
-											},
-											Env:          envList,
-											VolumeMounts: volumeMounts,
-										},
-									},
-									ImagePullSecrets: []v1.LocalObjectReference{
-										{
-											Name: fmt.Sprintf("chill-reg-%s", cfg.Name),
-										},
-									},
-								},
+				},
+			})
+		}
+		volumes = append(volumes, v1.Volume{
+			Name: "chill-config-mount",
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{Name: configMap.Name},
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      "chill-config-mount",
+			MountPath: naming.ConfigMountPath,
+		})
+	}
+	return &servingv1.RevisionTemplateSpec{
+		Spec: servingv1.RevisionSpec{
+			PodSpec: v1.PodSpec{
+				Volumes: volumes,
+				Containers: []v1.Container{
+					{
+						Image:           imageName,
+						ImagePullPolicy: pullPolicy,
+						Ports: []v1.ContainerPort{
+							{
+								Name:          "h2c",
+								Protocol:      v1.ProtocolTCP,
+								ContainerPort: servicePort,
 							},
 						},
+						Env:          envList,
+						VolumeMounts: volumeMounts,
 					},
 				},
-			}
+				ImagePullSecrets: []v1.LocalObjectReference{
+					{
+						Name: fmt.Sprintf("chill-reg-%s", cfg.Name),
+					},
+				},
+			},
+		},
+	}, nil
+}
 
-			if created {
-				service.SetResourceVersion(existingService.GetResourceVersion())
-				service.ObjectMeta = existingService.ObjectMeta
-				_, err = knative.Services(KubeNamespace).Update(context.TODO(), &service, metav1.UpdateOptions{})
-				if err != nil {
-					return fmt.Errorf("Knative server error while creating: %w\n", err)
-				}
-			} else {
-				service.ObjectMeta = metav1.ObjectMeta{
-					Name: name,
-				}
-				_, err = knative.Services(KubeNamespace).Create(context.TODO(), &service, metav1.CreateOptions{})
-
-				if err != nil {
-					return fmt.Errorf("Knative server error while updating: %w\n", err)
-				}
+func resourceList(r service.Resources) v1.ResourceList {
+	res := v1.ResourceList{}
+	if r.CPU != nil {
+		res[v1.ResourceCPU] = *r.CPU
+	}
+	if r.Memory != nil {
+		res[v1.ResourceMemory] = *r.Memory
+	}
+	if len(res) == 0 {
+		return nil
+	}
+	return res
+}
+
+// applyRuntime sets scaling annotations and resource constraints of the revision
+func applyRuntime(template *servingv1.RevisionTemplateSpec, r *service.RuntimeConfig) {
+	if r == nil {
+		return
+	}
+	annotations := map[string]string{}
+	if r.MinScale != nil {
+		annotations[autoscaling.MinScaleAnnotationKey] = strconv.Itoa(*r.MinScale)
+	}
+	if r.MaxScale != nil {
+		annotations[autoscaling.MaxScaleAnnotationKey] = strconv.Itoa(*r.MaxScale)
+	}
+	if r.TargetConcurrency != nil {
+		annotations[autoscaling.TargetAnnotationKey] = strconv.Itoa(*r.TargetConcurrency)
+	}
+	if len(annotations) > 0 {
+		template.ObjectMeta.Annotations = annotations
+	}
+	if r.ContainerConcurrency != nil {
+		template.Spec.ContainerConcurrency = util.Int64Ptr(int64(*r.ContainerConcurrency))
+	}
+	if r.TimeoutSeconds != nil {
+		template.Spec.TimeoutSeconds = util.Int64Ptr(int64(*r.TimeoutSeconds))
+	}
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].Resources = v1.ResourceRequirements{
+			Requests: resourceList(r.Requests),
+			Limits:   resourceList(r.Limits),
+		}
+	}
+}
+
+// defaultProbe queries grpc.health.v1 if the base project of the integration serves it and checks
+// the service port otherwise
+func defaultProbe(cfg *service.ProjectConfig) *service.Probe {
+	integration := server.ForName(cfg.Integration)
+	if integration != nil && integration.ImplementsHealthCheck() {
+		return &service.Probe{Type: service.ProbeGRPC}
+	}
+	return &service.Probe{Type: service.ProbeTCP}
+}
+
+func optionalInt32(v *int) int32 {
+	if v == nil {
+		return 0
+	}
+	return int32(*v)
+}
+
+// grpcHealthProbe is the grpc.health.v1 client shipped by base projects serving health checks
+const grpcHealthProbe = "grpc_health_probe"
+
+// grpcProbeCommand queries grpc.health.v1 of the service port; native gRPC probes are rejected by Knative
+func grpcProbeCommand(p *service.Probe) []string {
+	command := []string{grpcHealthProbe, fmt.Sprintf("-addr=:%d", servicePort)}
+	if p.GRPCService != "" {
+		command = append(command, "-service="+p.GRPCService)
+	}
+	return command
+}
+
+// buildProbe converts the probe to Kubernetes one; HTTP and TCP ports are left for Knative to fill
+func buildProbe(p *service.Probe) *v1.Probe {
+	if p == nil {
+		return nil
+	}
+	var handler v1.ProbeHandler
+	switch p.Type {
+	case service.ProbeGRPC:
+		handler.Exec = &v1.ExecAction{Command: grpcProbeCommand(p)}
+	case service.ProbeHTTP:
+		handler.HTTPGet = &v1.HTTPGetAction{Path: p.Path}
+	case service.ProbeTCP:
+		handler.TCPSocket = &v1.TCPSocketAction{}
+	case service.ProbeExec:
+		handler.Exec = &v1.ExecAction{Command: p.Command}
+	default:
+		return nil
+	}
+	return &v1.Probe{
+		ProbeHandler:        handler,
+		InitialDelaySeconds: optionalInt32(p.InitialDelaySeconds),
+		PeriodSeconds:       optionalInt32(p.PeriodSeconds),
+		TimeoutSeconds:      optionalInt32(p.TimeoutSeconds),
+		FailureThreshold:    optionalInt32(p.FailureThreshold),
+	}
+}
+
+// applyProbes sets container probes, falling back to the integration defaults
+func applyProbes(template *servingv1.RevisionTemplateSpec, cfg *service.ProjectConfig) {
+	liveness := defaultProbe(cfg)
+	readiness := defaultProbe(cfg)
+	if cfg.Probes != nil {
+		if cfg.Probes.Liveness != nil {
+			liveness = cfg.Probes.Liveness
+		}
+		if cfg.Probes.Readiness != nil {
+			readiness = cfg.Probes.Readiness
+		}
+	}
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].LivenessProbe = buildProbe(liveness)
+		template.Spec.Containers[i].ReadinessProbe = buildProbe(readiness)
+	}
+}
+
+// buildService computes the Knative service to be sent to the cluster
+func buildService(
+	cfg *service.ProjectConfig,
+	clusterManager cluster.ClusterManager,
+	existingService *servingv1.Service,
+) (*servingv1.Service, error) {
+	trafficList, err := buildTrafficList(cfg, existingService)
+	if err != nil {
+		return nil, err
+	}
+	template, err := buildRevisionTemplate(cfg, clusterManager)
+	if err != nil {
+		return nil, err
+	}
+	applyRuntime(template, cfg.Runtime)
+	applyProbes(template, cfg)
+	return &servingv1.Service{
+		ObjectMeta: existingService.ObjectMeta,
+		Spec: servingv1.ServiceSpec{
+			RouteSpec: servingv1.RouteSpec{
+				Traffic: trafficList,
+			},
+			ConfigurationSpec: servingv1.ConfigurationSpec{
+				Template: *template,
+			},
+		},
+	}, nil
+}
+
+// marshalManifests serializes the objects in the requested output format: a multi-document YAML stream
+// or a single JSON list, so that either can be piped to kubectl
+func marshalManifests(objs []runtime.Object, format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		var docs []string
+		for _, obj := range objs {
+			out, err := yaml.Marshal(obj)
+			if err != nil {
+				return nil, err
 			}
-			return nil
+			docs = append(docs, string(out))
+		}
+		return []byte(strings.Join(docs, "---\n")), nil
+	case "json":
+		list := &v1.List{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"}}
+		for _, obj := range objs {
+			list.Items = append(list.Items, runtime.RawExtension{Object: obj})
+		}
+		out, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(out, '\n'), nil
+	default:
+		return nil, fmt.Errorf("unknown output format %s", format)
+	}
+}
+
+func runDeployDryRun(cfg *service.ProjectConfig) error {
+	name := fmt.Sprintf("%s-v%d", cfg.Name, cfg.CurrentVersion.GetMajor())
+
+	// The cluster is only queried if it is reachable; rendering itself
+	// does not depend on it
+	var knative v12.ServingV1Interface
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		logging.Logger.Info(fmt.Sprintf("Cluster is not configured: %s", err.Error()))
+		clusterManager = cluster.NewOffline(KubeNamespace)
+	} else {
+		knative, err = clusterManager.GetKnative()
+		if err != nil {
+			logging.Logger.Info(fmt.Sprintf("Unable to build Knative client: %s", err.Error()))
+		}
+	}
+
+	existingService := &servingv1.Service{}
+	created := false
+	if knative != nil {
+		existingService, created, err = getKnativeService(knative, name)
+		if err != nil {
+			logging.Logger.Warn(fmt.Sprintf("Cluster is not reachable, no diff will be shown: %s", err.Error()))
+			existingService = &servingv1.Service{}
+		}
+	}
+
+	service, err := buildService(cfg, clusterManager, existingService)
+	if errors2.Is(err, errRetryLocked) {
+		return fmt.Errorf("version %s cannot be deployed after the live ones", cfg.CurrentVersion.String())
+	}
+	if err != nil {
+		return err
+	}
+	service.TypeMeta = metav1.TypeMeta{
+		APIVersion: servingv1.SchemeGroupVersion.String(),
+		Kind:       "Service",
+	}
+	service.ObjectMeta = metav1.ObjectMeta{
+		Name:      name,
+		Namespace: KubeNamespace,
+	}
+
+	configMap, err := buildConfigMap(cfg, clusterManager)
+	if err != nil {
+		return err
+	}
+	var objs []runtime.Object
+	if configMap != nil {
+		configMap.Namespace = KubeNamespace
+		objs = append(objs, configMap)
+	}
+	objs = append(objs, service)
+	out, err := marshalManifests(objs, dryRunOutput)
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+
+	if created {
+		// Only specs are compared since metadata and status are maintained by the cluster
+		live, err := yaml.Marshal(existingService.Spec)
+		if err != nil {
+			return err
+		}
+		rendered, err := yaml.Marshal(service.Spec)
+		if err != nil {
+			return err
+		}
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        difflib.SplitLines(string(live)),
+			B:        difflib.SplitLines(string(rendered)),
+			FromFile: "live",
+			ToFile:   "rendered",
+			Context:  3,
+		})
+		if err != nil {
+			return err
+		}
+		// The diff goes to stderr, so that the manifests might be piped
+		if diff == "" {
+			fmt.Fprintln(os.Stderr, "# No changes against the live service")
 		} else {
-			logging.Logger.Info(fmt.Sprintf("Lock %d failed, waiting...", i))
-			time.Sleep(time.Duration(sleepTime) * time.Second)
+			fmt.Fprintf(os.Stderr, "# Diff against the live service spec:\n%s", diff)
 		}
 	}
-	return fmt.Errorf("Failed to take a lock\n")
+	return nil
+}
+
+// localStateDir keeps files chill generates in the project
+const localStateDir = ".chill"
+
+// checkClean makes sure the deployed version is committed; the only change allowed
+// is the image digest recorded in the lock file by push after freezing
+func checkClean(cwd string, s cache.SourceOfTruth) error {
+	files, err := s.IsClean()
+	if err != nil {
+		return err
+	}
+	var dirty []string
+	for _, f := range files {
+		// Local state, such as generated SBOMs, does not affect what is deployed
+		if !strings.HasPrefix(f, localStateDir+"/") {
+			dirty = append(dirty, f)
+		}
+	}
+	if len(dirty) == 0 {
+		return nil
+	}
+	errDirty := fmt.Errorf("uncommitted or untracked changes detected; commit or stash them")
+	if len(dirty) != 1 || dirty[0] != config.LockConfigName {
+		return errDirty
+	}
+	data, err := s.GetCommittedFile(config.LockConfigName)
+	if err != nil {
+		return errDirty
+	}
+	committed, err := config.ParseConfigData(data, true)
+	if err != nil {
+		return err
+	}
+	current, err := config.ParseConfig(cwd, config.LockConfigName, true)
+	if err != nil {
+		return err
+	}
+	committed.ImageDigest = current.ImageDigest
+	// Configs are compared serialized since dependencies are keyed by pointers
+	a, err := config.ProcessConfig(committed)
+	if err != nil {
+		return err
+	}
+	b, err := config.ProcessConfig(current)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(a, b) {
+		return errDirty
+	}
+	return nil
+}
+
+// deployService applies the built version of the service to the cluster through the backend,
+// rolling it out by the given steps if there are any, and waits for it if the timeout is positive
+func deployService(
+	cfg *service.ProjectConfig,
+	clusterManager cluster.ClusterManager,
+	backend deployBackend,
+	steps []int,
+	timeout time.Duration,
+) error {
+	name := clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+
+	err := withServiceLock(clusterManager, name, func() error {
+		configMap, err := buildConfigMap(cfg, clusterManager)
+		if err != nil {
+			return err
+		}
+		if configMap != nil {
+			err = applyConfigMap(clusterManager, configMap)
+			if err != nil {
+				return fmt.Errorf("unable to apply config map: %w", err)
+			}
+		}
+		return backend.Deploy(cfg, name, steps)
+	})
+	if err != nil {
+		return err
+	}
+
+	if timeout > 0 && len(steps) == 0 {
+		return backend.Wait(cfg, name, timeout)
+	}
+	return nil
 }
 
 var forceFrozen bool
-var attemptsLimit int
-var sleepTime int
-var lockTimeout int
+var withDependencies bool
+var dryRun bool
+var dryRunOutput string
+var waitTimeout time.Duration
+var requireSignature bool
 
 // deployCmd represents the deploy command
 var deployCmd = &cobra.Command{
@@ -314,7 +770,15 @@ func init() {
 	rootCmd.AddCommand(deployCmd)
 
 	deployCmd.Flags().BoolVarP(&forceFrozen, "force-frozen", "f", false, "Force mark state as frozen")
-	deployCmd.Flags().IntVar(&attemptsLimit, "attempts-limit", 5, "Number of tries to take a lock")
-	deployCmd.Flags().IntVar(&sleepTime, "sleep-time", 10, "Timeout between tries to take a lock")
-	deployCmd.Flags().IntVar(&lockTimeout, "lock-timeout", 30, "Lock timeout")
+	deployCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the service instead of deploying it")
+	deployCmd.Flags().StringVarP(&dryRunOutput, "output", "o", "yaml", "Dry run output format (yaml or json)")
+	deployCmd.Flags().DurationVar(&waitTimeout, "wait", 0, "Wait for the new revision to become ready, with the given timeout")
+	deployCmd.Flags().Lookup("wait").NoOptDefVal = "5m"
+	deployCmd.Flags().IntSliceVar(&canarySteps, "canary", nil, "Roll the version out by the given traffic percents ending with 100, e.g. 5,25,50,100")
+	deployCmd.Flags().DurationVar(&canaryInterval, "interval", 2*time.Minute, "Time between canary steps")
+	deployCmd.Flags().StringVar(&canaryCheck, "check", "", "Shell command that must succeed after each canary step, including the final one")
+	deployCmd.Flags().BoolVar(&withDependencies, "with-dependencies", false, "Deploy locked versions of all the dependencies first")
+	deployCmd.Flags().BoolVar(&requireSignature, "require-signature", false, "Only deploy images pinned by digest and signed by a key listed in the signing settings")
+	addLockFlags(deployCmd)
+	addLoaderFlags(deployCmd)
 }
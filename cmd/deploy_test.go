@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"encoding/json"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/config"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"go.uber.org/zap"
+	"io"
+	v1 "k8s.io/api/core/v1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"testing"
+)
+
+// captureStdout returns what f prints
+func captureStdout(t *testing.T, f func() error) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	printed := make(chan string, 1)
+	go func() {
+		data, _ := io.ReadAll(r)
+		printed <- string(data)
+	}()
+	err = f()
+	os.Stdout = stdout
+	_ = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return <-printed
+}
+
+func TestDeployDryRun(t *testing.T) {
+	// The cluster is not configured, so the manifests are rendered offline
+	Kubeconfig, KubeNamespace, logging.Logger = filepath.Join(t.TempDir(), "missing"), "staging", zap.NewNop()
+	defer func() {
+		Kubeconfig, KubeNamespace, logging.Logger, dryRunOutput = "", v1.NamespaceDefault, nil, "yaml"
+	}()
+	cfg := &service.ProjectConfig{
+		Name:           "demo",
+		Registry:       "registry.example.com/team",
+		CurrentVersion: &version.Version{Major: 1, Minor: 2},
+		Config:         map[string]string{"LOG_LEVEL": "info"},
+	}
+
+	dryRunOutput = "yaml"
+	out := captureStdout(t, func() error {
+		return runDeployDryRun(cfg)
+	})
+	docs := strings.Split(out, "\n---\n")
+	if len(docs) != 2 {
+		t.Fatalf("config map and service expected, got:\n%s", out)
+	}
+	// Every document must be a manifest, nothing else is printed to stdout
+	for _, doc := range docs {
+		var obj map[string]interface{}
+		err := yaml.UnmarshalStrict([]byte(doc), &obj)
+		if err != nil || obj["kind"] == nil {
+			t.Fatalf("wrong YAML document rendered: %v\n%s", err, doc)
+		}
+	}
+	var configMap v1.ConfigMap
+	err := yaml.Unmarshal([]byte(docs[0]), &configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configMap.Kind != "ConfigMap" || configMap.Namespace != "staging" || configMap.Data["LOG_LEVEL"] != "info" {
+		t.Fatalf("wrong config map rendered:\n%s", docs[0])
+	}
+	var svc servingv1.Service
+	err = yaml.Unmarshal([]byte(docs[1]), &svc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc.Kind != "Service" || svc.Name != "demo-v1" || svc.Namespace != "staging" {
+		t.Fatalf("wrong service rendered:\n%s", docs[1])
+	}
+	containers := svc.Spec.Template.Spec.Containers
+	if len(containers) != 1 || containers[0].Image != "registry.example.com/team/demo:v1.2.0" {
+		t.Fatalf("wrong containers rendered: %v", containers)
+	}
+	if strings.Contains(out, "# Diff") {
+		t.Fatal("diff rendered without a live service")
+	}
+
+	dryRunOutput = "json"
+	out = captureStdout(t, func() error {
+		return runDeployDryRun(cfg)
+	})
+	// The whole output is a single list, so that it might be piped to kubectl
+	var list v1.List
+	err = json.Unmarshal([]byte(out), &list)
+	if err != nil {
+		t.Fatalf("wrong JSON rendered: %v\n%s", err, out)
+	}
+	var kinds []string
+	for _, item := range list.Items {
+		var obj struct{ Kind string }
+		err = json.Unmarshal(item.Raw, &obj)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kinds = append(kinds, obj.Kind)
+	}
+	if list.Kind != "List" || strings.Join(kinds, ",") != "ConfigMap,Service" {
+		t.Fatalf("config map and service expected, got %s %v", list.Kind, kinds)
+	}
+}
+
+func TestDeployProbes(t *testing.T) {
+	Kubeconfig, logging.Logger = filepath.Join(t.TempDir(), "missing"), zap.NewNop()
+	defer func() {
+		Kubeconfig, logging.Logger, dryRunOutput = "", nil, "yaml"
+	}()
+	for _, tc := range []struct {
+		integration string
+		command     []string
+		tcp         bool
+	}{
+		{integration: "go", command: []string{"grpc_health_probe", "-addr=:80"}},
+		{integration: "python", tcp: true},
+	} {
+		cfg := &service.ProjectConfig{
+			Name:           "demo",
+			Integration:    tc.integration,
+			Registry:       "registry.example.com/team",
+			CurrentVersion: &version.Version{Major: 1, Minor: 2},
+		}
+		dryRunOutput = "yaml"
+		out := captureStdout(t, func() error {
+			return runDeployDryRun(cfg)
+		})
+		var svc servingv1.Service
+		err := yaml.Unmarshal([]byte(out), &svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		container := svc.Spec.Template.Spec.Containers[0]
+		for _, p := range []*v1.Probe{container.LivenessProbe, container.ReadinessProbe} {
+			// Knative only admits HTTP, TCP and exec probes
+			if p == nil || p.GRPC != nil || p.HTTPGet != nil {
+				t.Fatalf("%s: wrong probe rendered:\n%s", tc.integration, out)
+			}
+			if tc.tcp != (p.TCPSocket != nil) {
+				t.Fatalf("%s: wrong probe rendered:\n%s", tc.integration, out)
+			}
+			if !tc.tcp && (p.Exec == nil || strings.Join(p.Exec.Command, " ") != strings.Join(tc.command, " ")) {
+				t.Fatalf("%s: wrong probe command rendered:\n%s", tc.integration, out)
+			}
+		}
+	}
+}
+
+func TestDeployPullPolicy(t *testing.T) {
+	defer func() {
+		LocalLoader, ForceLocal = loaderMinikube, false
+	}()
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	for _, tc := range []struct {
+		loader   string
+		registry string
+		digest   string
+		expected v1.PullPolicy
+	}{
+		// Images side-loaded to the nodes are never pushed, so they must not be pulled
+		{loader: loaderMinikube, expected: v1.PullIfNotPresent},
+		{loader: loaderKind, expected: v1.PullIfNotPresent},
+		{loader: loaderRegistry, expected: v1.PullAlways},
+		{loader: loaderKind, registry: "registry.example.com/team", expected: v1.PullAlways},
+		{loader: loaderKind, registry: "registry.example.com/team", digest: "sha256:abc", expected: v1.PullIfNotPresent},
+	} {
+		LocalLoader = tc.loader
+		cfg := &service.ProjectConfig{
+			Name:           "demo",
+			Registry:       tc.registry,
+			ImageDigest:    tc.digest,
+			CurrentVersion: &version.Version{Major: 1, Minor: 2},
+		}
+		template, err := buildRevisionTemplate(cfg, clusterManager)
+		if err != nil {
+			t.Fatal(err)
+		}
+		policy := template.Spec.Containers[0].ImagePullPolicy
+		if policy != tc.expected {
+			t.Fatalf("%s %q %q: image pulled with %s", tc.loader, tc.registry, tc.digest, policy)
+		}
+	}
+
+	// Forcing a local build takes the policy from the loader even if the registry is set
+	LocalLoader, ForceLocal = loaderMinikube, true
+	cfg := &service.ProjectConfig{
+		Name:           "demo",
+		Registry:       "registry.example.com/team",
+		CurrentVersion: &version.Version{Major: 1, Minor: 2},
+	}
+	template, err := buildRevisionTemplate(cfg, clusterManager)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if template.Spec.Containers[0].ImagePullPolicy != v1.PullIfNotPresent {
+		t.Fatalf("forced local image pulled with %s", template.Spec.Containers[0].ImagePullPolicy)
+	}
+}
+
+func TestDeployDryRunRequiresSignature(t *testing.T) {
+	projectDir, logging.Logger = t.TempDir(), zap.NewNop()
+	dryRun, requireSignature = true, true
+	defer func() {
+		projectDir, logging.Logger = "", nil
+		dryRun, requireSignature = false, false
+	}()
+	cfg := &service.ProjectConfig{
+		Name:           "demo",
+		Registry:       "registry.example.com/team",
+		CurrentVersion: &version.Version{Major: 1, Minor: 2},
+	}
+	s, err := config.ProcessConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.SaveToFile(filepath.Join(projectDir, config.LockConfigName), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// No digest is recorded, so the signature of the image cannot be verified
+	err = RunDeploy(deployCmd, nil)
+	if err == nil || !strings.Contains(err.Error(), "not pinned") {
+		t.Fatalf("unsigned image rendered: %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/integrations/server"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"knative.dev/serving/pkg/apis/autoscaling"
+	"knative.dev/serving/pkg/apis/serving"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// devBuildAnnotation changes with every rebuild, so Knative rolls a new revision for the same image tag
+const devBuildAnnotation = "chill.cloud/dev-build"
+
+var devInterval time.Duration
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// snapshotTree records modification stamps of all the files in the directory, which might be missing
+func snapshotTree(root string) (map[string]fileStamp, error) {
+	res := map[string]fileStamp{}
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			res[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// deployDevRevision rolls a new revision of the current version which receives no traffic
+// and returns the name of the service
+func deployDevRevision(
+	cfg *service.ProjectConfig,
+	clusterManager cluster.ClusterManager,
+	pullPolicy v1.PullPolicy,
+	build int,
+) (string, error) {
+	knative, err := clusterManager.GetKnative()
+	if err != nil {
+		return "", fmt.Errorf("unable to build Knative client")
+	}
+	name := clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+	err = withServiceLock(clusterManager, name, func() error {
+		configMap, err := buildConfigMap(cfg, clusterManager)
+		if err != nil {
+			return err
+		}
+		if configMap != nil {
+			err = applyConfigMap(clusterManager, configMap)
+			if err != nil {
+				return fmt.Errorf("Kubernetes server error while applying config map: %w\n", err)
+			}
+		}
+
+		existingService, created, err := getKnativeService(knative, name)
+		if err != nil {
+			return err
+		}
+		tag := cluster.RevisionTag(*cfg.CurrentVersion)
+		for _, t := range existingService.Status.Traffic {
+			if t.Tag == tag && t.Percent != nil && *t.Percent > 0 {
+				return fmt.Errorf("version %s receives traffic already; sync to get a development version", cfg.CurrentVersion.String())
+			}
+		}
+
+		template, err := buildRevisionTemplate(cfg, clusterManager)
+		if err != nil {
+			return err
+		}
+		applyRuntime(template, cfg.Runtime)
+		applyProbes(template, cfg)
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[devBuildAnnotation] = strconv.Itoa(build)
+		// Keep a pod running to have logs to stream even with no requests
+		template.Annotations[autoscaling.MinScaleAnnotationKey] = "1"
+		for i := range template.Spec.Containers {
+			template.Spec.Containers[i].ImagePullPolicy = pullPolicy
+		}
+
+		return applyKnativeService(knative, name, existingService, created, &servingv1.Service{
+			ObjectMeta: existingService.ObjectMeta,
+			Spec: servingv1.ServiceSpec{
+				RouteSpec: servingv1.RouteSpec{
+					Traffic: buildDevelopmentTrafficList(cfg, existingService),
+				},
+				ConfigurationSpec: servingv1.ConfigurationSpec{
+					Template: *template,
+				},
+			},
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// devRevision returns the revision and the URL of the tag of the current version
+func devRevision(clusterManager cluster.ClusterManager, cfg *service.ProjectConfig, name string) (string, string, error) {
+	knative, err := clusterManager.GetKnative()
+	if err != nil {
+		return "", "", fmt.Errorf("unable to build Knative client")
+	}
+	svc, err := knative.Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", "", err
+	}
+	tag := cluster.RevisionTag(*cfg.CurrentVersion)
+	for _, t := range svc.Status.Traffic {
+		if t.Tag == tag && t.URL != nil {
+			return t.RevisionName, t.URL.String(), nil
+		}
+	}
+	return "", "", fmt.Errorf("no traffic target tagged %s found", tag)
+}
+
+// streamRevisionLogs follows logs of every pod of the revision until the context is cancelled
+func streamRevisionLogs(ctx context.Context, k8sClient *kubernetes.Clientset, revision string) {
+	streamed := map[string]bool{}
+	_ = wait.PollImmediateUntil(waitPollInterval, func() (bool, error) {
+		pods, err := k8sClient.CoreV1().Pods(KubeNamespace).List(ctx, metav1.ListOptions{
+			LabelSelector: fmt.Sprintf("%s=%s", serving.RevisionLabelKey, revision),
+		})
+		if err != nil {
+			logging.Logger.Info(fmt.Sprintf("Unable to list pods: %s", err.Error()))
+			return false, nil
+		}
+		for _, pod := range pods.Items {
+			if streamed[pod.Name] || pod.Status.Phase != v1.PodRunning {
+				continue
+			}
+			streamed[pod.Name] = true
+			go streamPodLogs(ctx, k8sClient, pod.Name)
+		}
+		return false, nil
+	}, ctx.Done())
+}
+
+// revisionLogs streams logs of the latest revision only
+type revisionLogs struct {
+	cancel context.CancelFunc
+}
+
+func (l *revisionLogs) follow(ctx context.Context, k8sClient *kubernetes.Clientset, revision string) {
+	l.stop()
+	ctx, l.cancel = context.WithCancel(ctx)
+	go streamRevisionLogs(ctx, k8sClient, revision)
+}
+
+func (l *revisionLogs) stop() {
+	if l.cancel != nil {
+		l.cancel()
+	}
+}
+
+func streamPodLogs(ctx context.Context, k8sClient *kubernetes.Clientset, pod string) {
+	logs, err := k8sClient.CoreV1().Pods(KubeNamespace).GetLogs(pod, &v1.PodLogOptions{
+		Container: userContainerName,
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		logging.Logger.Warn(fmt.Sprintf("Unable to stream logs of pod %s: %s", pod, err.Error()))
+		return
+	}
+	defer logs.Close()
+	scanner := bufio.NewScanner(logs)
+	for scanner.Scan() {
+		fmt.Printf("[%s] %s\n", pod, scanner.Text())
+	}
+}
+
+func RunDev(cmd *cobra.Command, args []string) error {
+	cwd, err := setupProjectDir()
+	if err != nil {
+		return err
+	}
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	err = cfg.ApplyEnvironment(Environment)
+	if err != nil {
+		return err
+	}
+	if Backend != backendKnative {
+		return fmt.Errorf("development loop is only supported by the %s backend", backendKnative)
+	}
+	integration := server.ForName(cfg.Integration)
+	if integration == nil {
+		return fmt.Errorf("no integration found for name %s", cfg.Integration)
+	}
+	// Development images never leave the local cluster
+	ForceLocal = true
+	loader, err := newLocalLoader()
+	if err != nil {
+		return err
+	}
+
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return fmt.Errorf("unable to build cluster client")
+	}
+	k8sClient, err := clusterManager.GetKubernetesClient()
+	if err != nil {
+		return fmt.Errorf("unable to build Kubernetes client")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	srcCwd := filepath.Join(cwd, "src")
+	apiCwd := filepath.Join(cwd, "api")
+	var src, api map[string]fileStamp
+	var logs revisionLogs
+	defer logs.stop()
+	for build := 1; ; build++ {
+		if build > 1 {
+			fmt.Println("Waiting for changes...")
+		}
+		// Changes are polled to get notified about files created in new directories as well
+		err = wait.PollImmediateUntil(devInterval, func() (bool, error) {
+			newApi, err := snapshotTree(apiCwd)
+			if err != nil {
+				return false, err
+			}
+			if api != nil && !reflect.DeepEqual(api, newApi) {
+				fmt.Println("API changes detected, generating server stubs...")
+				err = integration.GenerateMethods(srcCwd, cfg.Name, cwd)
+				if err != nil {
+					return false, err
+				}
+			}
+			newSrc, err := snapshotTree(srcCwd)
+			if err != nil {
+				return false, err
+			}
+			changed := src == nil || !reflect.DeepEqual(src, newSrc) || !reflect.DeepEqual(api, newApi)
+			src, api = newSrc, newApi
+			return changed, nil
+		}, ctx.Done())
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		err = buildImage(cwd, cfg)
+		if err == nil {
+			_, err = pushImage(cwd, cfg)
+		}
+		if err != nil {
+			fmt.Printf("Build failed: %s\n", err.Error())
+			continue
+		}
+		name, err := deployDevRevision(cfg, clusterManager, loader.PullPolicy(), build)
+		if err != nil {
+			return err
+		}
+		err = waitForService(clusterManager, name, defaultReadyTimeout)
+		if err != nil {
+			fmt.Printf("Revision failed: %s\n", err.Error())
+			continue
+		}
+		revision, url, err := devRevision(clusterManager, cfg, name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Development revision %s is available at %s\n", revision, url)
+
+		logs.follow(ctx, k8sClient, revision)
+	}
+	return nil
+}
+
+// devCmd represents the dev command
+var devCmd = &cobra.Command{
+	Use:   "dev",
+	Short: "Runs the development loop against the cluster",
+	Long: `Watches src/ and api/ of the service. API changes regenerate server stubs,
+and every change rebuilds the image with the local tag and rolls a new
+revision of the current version. The revision receives no traffic, but it
+is reachable by the stable URL of the version tag. Container logs of the
+revision are streamed until the next rebuild.
+
+The local tag is reused by every rebuild. With the registry loader, add
+the local registry to registries-skipping-tag-resolving of the
+config-deployment config map in knative-serving, so that Knative does
+not try to resolve the tag and nodes pull it again for every revision.`,
+	Args: cobra.NoArgs,
+	RunE: RunDev,
+}
+
+func init() {
+	rootCmd.AddCommand(devCmd)
+
+	addLoaderFlags(devCmd)
+	devCmd.Flags().DurationVar(&devInterval, "interval", time.Second, "Interval of polling files for changes")
+}
@@ -3,7 +3,6 @@ package cmd
 import (
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
 	"github.com/chill-cloud/chill-cli/pkg/service/naming"
 	"github.com/spf13/cobra"
 )
@@ -13,7 +12,7 @@ func RunEnv(cmd *cobra.Command, args []string) error {
 	if len(args) > 0 {
 		name = args[0]
 	} else {
-		cwd, err := cwd.SetupCwd(Cwd)
+		cwd, err := setupProjectDir()
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,446 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/util"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
+)
+
+const exportPlaceholder = "REPLACE_ME"
+
+var exportFormat string
+var exportDir string
+
+// exportParams holds values which are either rendered as is or parameterised by the output format
+type exportParams struct {
+	Image        string
+	RevisionName string
+	// Traffic is left out of the service if nil
+	Traffic      []servingv1.TrafficTarget
+	RegistryAuth string
+	SecretValue  func(key string) string
+}
+
+type exportObject struct {
+	File string
+	Obj  interface{}
+}
+
+// exportRevisionName names the revision explicitly, so that the traffic of later exports might refer to it
+func exportRevisionName(serviceIdentifier string, v version.Version) string {
+	return fmt.Sprintf("%s-%s", serviceIdentifier, cluster.RevisionTag(v))
+}
+
+// exportTraffic routes traffic of the major service according to the traffic targets of the project
+func exportTraffic(cfg *service.ProjectConfig, serviceIdentifier string) ([]servingv1.TrafficTarget, error) {
+	targets, err := cfg.GetTrafficTargets()
+	if err != nil {
+		return nil, err
+	}
+	var versions []version.Version
+	for v := range targets {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Compare(versions[j]) < 0
+	})
+	var res []servingv1.TrafficTarget
+	for _, v := range versions {
+		res = append(res, servingv1.TrafficTarget{
+			RevisionName:   exportRevisionName(serviceIdentifier, v),
+			Tag:            cluster.RevisionTag(v),
+			LatestRevision: util.BoolPtr(false),
+			Percent:        util.Int64Ptr(int64(targets[v])),
+		})
+	}
+	return res, nil
+}
+
+func registryHost(cfg *service.ProjectConfig) string {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	return strings.Split(imageName, "/")[0]
+}
+
+// buildExportObjects computes everything deploy would create in the cluster
+func buildExportObjects(
+	cfg *service.ProjectConfig,
+	clusterManager cluster.ClusterManager,
+	params exportParams,
+) ([]exportObject, error) {
+	name := clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+	template, err := buildRevisionTemplate(cfg, clusterManager)
+	if err != nil {
+		return nil, err
+	}
+	applyRuntime(template, cfg.Runtime)
+	applyProbes(template, cfg)
+	template.Name = params.RevisionName
+	for i := range template.Spec.Containers {
+		template.Spec.Containers[i].Image = params.Image
+	}
+	svc := &servingv1.Service{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: servingv1.SchemeGroupVersion.String(),
+			Kind:       "Service",
+		},
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: servingv1.ServiceSpec{
+			RouteSpec: servingv1.RouteSpec{
+				Traffic: params.Traffic,
+			},
+			ConfigurationSpec: servingv1.ConfigurationSpec{
+				Template: *template,
+			},
+		},
+	}
+	res := []exportObject{{File: "service.yaml", Obj: svc}}
+
+	configMap, err := buildConfigMap(cfg, clusterManager)
+	if err != nil {
+		return nil, err
+	}
+	if configMap != nil {
+		res = append(res, exportObject{File: "config.yaml", Obj: configMap})
+	}
+
+	res = append(res, exportObject{File: "lock.yaml", Obj: &v1.ConfigMap{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{Name: lockConfigMapName(name)},
+	}})
+
+	res = append(res, exportObject{File: "registry-secret.yaml", Obj: &v1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("chill-reg-%s", cfg.Name)},
+		Type:       v1.SecretTypeDockerConfigJson,
+		StringData: map[string]string{
+			v1.DockerConfigJsonKey: fmt.Sprintf(`{"auths":{"%s":{"auth":"%s"}}}`, registryHost(cfg), params.RegistryAuth),
+		},
+	}})
+
+	for _, s := range cfg.Secrets {
+		res = append(res, exportObject{File: fmt.Sprintf("secret-%s.yaml", s), Obj: &v1.Secret{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{Name: s},
+			Type:       v1.SecretTypeOpaque,
+			StringData: map[string]string{cluster.ChillSecretKey: params.SecretValue(s)},
+		}})
+	}
+	return res, nil
+}
+
+// cleanManifest drops fields maintained by the cluster
+func cleanManifest(obj interface{}, namespace string) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var res map[string]interface{}
+	err = json.Unmarshal(data, &res)
+	if err != nil {
+		return nil, err
+	}
+	delete(res, "status")
+	dropNulls(res)
+	if namespace != "" {
+		res["metadata"].(map[string]interface{})["namespace"] = namespace
+	}
+	return res, nil
+}
+
+// dropNulls removes unset fields like creation timestamps, which are not omitted by their types
+func dropNulls(v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if child == nil {
+				delete(t, k)
+				continue
+			}
+			dropNulls(child)
+		}
+	case []interface{}:
+		for _, child := range t {
+			dropNulls(child)
+		}
+	}
+}
+
+func writeManifest(path string, obj interface{}) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func writeManifests(dir string, objects []exportObject, namespace string) ([]string, error) {
+	var files []string
+	for _, o := range objects {
+		m, err := cleanManifest(o.Obj, namespace)
+		if err != nil {
+			return nil, err
+		}
+		err = writeManifest(filepath.Join(dir, o.File), m)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, o.File)
+	}
+	return files, nil
+}
+
+func placeholderSecret(string) string {
+	return exportPlaceholder
+}
+
+func exportRaw(cfg *service.ProjectConfig, clusterManager cluster.ClusterManager, dir string, traffic []servingv1.TrafficTarget) error {
+	imageName, _ := cfg.GetImageRef(ForceLocal)
+	name := clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+	objects, err := buildExportObjects(cfg, clusterManager, exportParams{
+		Image:        imageName,
+		RevisionName: exportRevisionName(name, *cfg.CurrentVersion),
+		Traffic:      traffic,
+		RegistryAuth: exportPlaceholder,
+		SecretValue:  placeholderSecret,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = writeManifests(dir, objects, KubeNamespace)
+	return err
+}
+
+// exportKustomize writes a base with the image tag and the traffic split kept in the kustomization and a patch
+func exportKustomize(cfg *service.ProjectConfig, clusterManager cluster.ClusterManager, dir string, traffic []servingv1.TrafficTarget) error {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	name := clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+	imageRepository := strings.TrimSuffix(imageName, ":"+cfg.CurrentVersion.String())
+	objects, err := buildExportObjects(cfg, clusterManager, exportParams{
+		Image:        imageRepository,
+		RevisionName: exportRevisionName(name, *cfg.CurrentVersion),
+		RegistryAuth: exportPlaceholder,
+		SecretValue:  placeholderSecret,
+	})
+	if err != nil {
+		return err
+	}
+	files, err := writeManifests(dir, objects, "")
+	if err != nil {
+		return err
+	}
+
+	err = writeManifest(filepath.Join(dir, "traffic.yaml"), map[string]interface{}{
+		"apiVersion": servingv1.SchemeGroupVersion.String(),
+		"kind":       "Service",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec":       map[string]interface{}{"traffic": traffic},
+	})
+	if err != nil {
+		return err
+	}
+	image := map[string]string{
+		"name":   imageRepository,
+		"newTag": cfg.CurrentVersion.String(),
+	}
+	if _, pinned := cfg.GetImageRef(ForceLocal); pinned {
+		image = map[string]string{
+			"name":   imageRepository,
+			"digest": cfg.ImageDigest,
+		}
+	}
+	return writeManifest(filepath.Join(dir, "kustomization.yaml"), map[string]interface{}{
+		"apiVersion":            "kustomize.config.k8s.io/v1beta1",
+		"kind":                  "Kustomization",
+		"namespace":             KubeNamespace,
+		"resources":             files,
+		"patchesStrategicMerge": []string{"traffic.yaml"},
+		"images":                []map[string]string{image},
+	})
+}
+
+// helmTrafficMarker takes the place of the traffic list in the service manifest until it is templated
+const helmTrafficMarker = "CHILL_HELM_TRAFFIC"
+
+var helmTrafficRe = regexp.MustCompile(`(?m)^( *)traffic: ` + helmTrafficMarker + `$`)
+
+// helmTrafficTemplate ranges over the traffic values, indented as the traffic field of the manifest
+func helmTrafficTemplate(indent string) string {
+	lines := []string{
+		"traffic:",
+		"{{- range .Values.traffic }}",
+		"- revisionName: {{ .revisionName }}",
+		"  tag: {{ .tag }}",
+		"  percent: {{ .percent }}",
+		"  latestRevision: false",
+		"{{- end }}",
+	}
+	return indent + strings.Join(lines, "\n"+indent)
+}
+
+// writeHelmService writes the service manifest with the traffic list templated, since Helm
+// can not express a list with a single value placeholder
+func writeHelmService(path string, svc interface{}) error {
+	m, err := cleanManifest(svc, "")
+	if err != nil {
+		return err
+	}
+	spec, ok := m["spec"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("service manifest has no spec")
+	}
+	spec["traffic"] = helmTrafficMarker
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	indent := helmTrafficRe.FindSubmatch(data)
+	if indent == nil {
+		return fmt.Errorf("unable to template the traffic of the service")
+	}
+	data = helmTrafficRe.ReplaceAllLiteral(data, []byte(helmTrafficTemplate(string(indent[1]))))
+	return os.WriteFile(path, data, 0644)
+}
+
+// exportHelm writes a chart with the image, the revision name, the traffic split and secrets taken from values
+func exportHelm(cfg *service.ProjectConfig, clusterManager cluster.ClusterManager, dir string, traffic []servingv1.TrafficTarget) error {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	name := clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+	templatesDir := filepath.Join(dir, "templates")
+	err := os.MkdirAll(templatesDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	objects, err := buildExportObjects(cfg, clusterManager, exportParams{
+		Image:        "{{ .Values.image.repository }}:{{ .Values.image.tag }}",
+		RevisionName: "{{ .Values.revisionName }}",
+		RegistryAuth: "{{ .Values.registryAuth }}",
+		SecretValue: func(key string) string {
+			return fmt.Sprintf(`{{ index .Values.secrets "%s" }}`, key)
+		},
+	})
+	if err != nil {
+		return err
+	}
+	// The service always goes first
+	err = writeHelmService(filepath.Join(templatesDir, objects[0].File), objects[0].Obj)
+	if err != nil {
+		return err
+	}
+	_, err = writeManifests(templatesDir, objects[1:], "")
+	if err != nil {
+		return err
+	}
+
+	var trafficValues []map[string]interface{}
+	for _, t := range traffic {
+		trafficValues = append(trafficValues, map[string]interface{}{
+			"revisionName": t.RevisionName,
+			"tag":          t.Tag,
+			"percent":      *t.Percent,
+		})
+	}
+	secrets := map[string]string{}
+	for _, s := range cfg.Secrets {
+		secrets[s] = ""
+	}
+	tag := cfg.CurrentVersion.String()
+	if _, pinned := cfg.GetImageRef(ForceLocal); pinned {
+		// The digest takes precedence over the tag kept for readability
+		tag = fmt.Sprintf("%s@%s", tag, cfg.ImageDigest)
+	}
+	err = writeManifest(filepath.Join(dir, "values.yaml"), map[string]interface{}{
+		"image": map[string]string{
+			"repository": strings.TrimSuffix(imageName, ":"+cfg.CurrentVersion.String()),
+			"tag":        tag,
+		},
+		"revisionName": exportRevisionName(name, *cfg.CurrentVersion),
+		"traffic":      trafficValues,
+		"registryAuth": "",
+		"secrets":      secrets,
+	})
+	if err != nil {
+		return err
+	}
+	return writeManifest(filepath.Join(dir, "Chart.yaml"), map[string]interface{}{
+		"apiVersion": "v2",
+		"name":       cfg.Name,
+		"version":    strings.TrimPrefix(cfg.CurrentVersion.String(), "v"),
+		"appVersion": cfg.CurrentVersion.String(),
+	})
+}
+
+func RunExport(cmd *cobra.Command, args []string) error {
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	err = cfg.ApplyEnvironment(Environment)
+	if err != nil {
+		return err
+	}
+	// Exported revisions are routed by the traffic targets, which only production versions have
+	if !version.IsProduction(*cfg.CurrentVersion) {
+		return fmt.Errorf("version %s is a development one; only production versions might be exported",
+			cfg.CurrentVersion.String())
+	}
+
+	// Export never queries the cluster, so names are resolved offline
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	traffic, err := exportTraffic(cfg, clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(exportDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	switch exportFormat {
+	case "raw":
+		err = exportRaw(cfg, clusterManager, exportDir, traffic)
+	case "kustomize":
+		err = exportKustomize(cfg, clusterManager, exportDir, traffic)
+	case "helm":
+		err = exportHelm(cfg, clusterManager, exportDir, traffic)
+	default:
+		return fmt.Errorf("unknown export format %s", exportFormat)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Manifests of %s %s exported to %s\n", cfg.Name, cfg.CurrentVersion.String(), exportDir)
+	return nil
+}
+
+// exportCmd represents the export command
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Writes manifests of the service for GitOps-managed clusters",
+	Long: `Writes everything deploy would create in the cluster to a directory:
+the Knative service, its plain configuration, the lock config map and
+placeholders for the registry and service secrets. Revisions are named
+explicitly, so the traffic split of later exports might refer to the
+revisions applied before. Only production versions might be exported.`,
+	Args: cobra.NoArgs,
+	RunE: RunExport,
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+
+	exportCmd.Flags().StringVar(&exportFormat, "format", "raw", "Output format (helm, kustomize or raw)")
+	exportCmd.Flags().StringVarP(&exportDir, "out", "d", "chill-export", "Directory to write manifests to")
+}
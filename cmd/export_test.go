@@ -0,0 +1,180 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	v1 "k8s.io/api/core/v1"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"os"
+	"path/filepath"
+	"sigs.k8s.io/yaml"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func readTestManifest(t *testing.T, path string, obj interface{}) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = yaml.Unmarshal(data, obj)
+	if err != nil {
+		t.Fatalf("%s: %v\n%s", path, err, data)
+	}
+}
+
+func exportTestConfig() *service.ProjectConfig {
+	return &service.ProjectConfig{
+		Name:           "demo",
+		Registry:       "registry.example.com/team",
+		CurrentVersion: &version.Version{Major: 1, Minor: 3},
+		Config:         map[string]string{"LOG_LEVEL": "info"},
+		Secrets:        []string{"db-password"},
+		TrafficTargets: map[version.Version]int{
+			{Major: 1, Minor: 2}: 90,
+			{Major: 1, Minor: 3}: 10,
+		},
+	}
+}
+
+// checkExportedService makes sure the service runs the image and splits the traffic of the fixture config
+func checkExportedService(t *testing.T, svc *servingv1.Service, image string) {
+	if svc.Kind != "Service" || svc.Name != "demo-v1" || svc.Spec.Template.Name != "demo-v1-v3-0" {
+		t.Fatalf("wrong service exported: %+v", svc.ObjectMeta)
+	}
+	if image != "" && svc.Spec.Template.Spec.Containers[0].Image != image {
+		t.Fatalf("wrong image exported: %s", svc.Spec.Template.Spec.Containers[0].Image)
+	}
+	var targets []string
+	for _, target := range svc.Spec.Traffic {
+		if target.LatestRevision == nil || *target.LatestRevision || target.Percent == nil {
+			t.Fatalf("traffic of %s not pinned to its revision", target.Tag)
+		}
+		targets = append(targets, fmt.Sprintf("%s=%d", target.RevisionName, *target.Percent))
+	}
+	if strings.Join(targets, ",") != "demo-v1-v2-0=90,demo-v1-v3-0=10" {
+		t.Fatalf("wrong traffic exported: %v", targets)
+	}
+}
+
+func TestExportRaw(t *testing.T) {
+	cfg := exportTestConfig()
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	traffic, err := exportTraffic(cfg, "demo-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = exportRaw(cfg, clusterManager, dir, traffic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var svc servingv1.Service
+	readTestManifest(t, filepath.Join(dir, "service.yaml"), &svc)
+	checkExportedService(t, &svc, "registry.example.com/team/demo:v1.3.0")
+	if svc.Namespace != KubeNamespace {
+		t.Fatalf("service exported to namespace %s", svc.Namespace)
+	}
+	var secret v1.Secret
+	readTestManifest(t, filepath.Join(dir, "secret-db-password.yaml"), &secret)
+	if secret.StringData[cluster.ChillSecretKey] != exportPlaceholder {
+		t.Fatal("secret value exported")
+	}
+}
+
+func TestExportKustomize(t *testing.T) {
+	cfg := exportTestConfig()
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	traffic, err := exportTraffic(cfg, "demo-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = exportKustomize(cfg, clusterManager, dir, traffic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kustomization struct {
+		Namespace             string
+		Resources             []string
+		PatchesStrategicMerge []string `json:"patchesStrategicMerge"`
+		Images                []map[string]string
+	}
+	readTestManifest(t, filepath.Join(dir, "kustomization.yaml"), &kustomization)
+	if kustomization.Namespace != KubeNamespace || len(kustomization.Images) != 1 ||
+		kustomization.Images[0]["name"] != "registry.example.com/team/demo" ||
+		kustomization.Images[0]["newTag"] != "v1.3.0" {
+		t.Fatalf("wrong kustomization exported: %+v", kustomization)
+	}
+	for _, f := range append(kustomization.Resources, kustomization.PatchesStrategicMerge...) {
+		if _, err := os.Stat(filepath.Join(dir, f)); err != nil {
+			t.Fatalf("kustomization refers to a missing file: %v", err)
+		}
+	}
+	var svc servingv1.Service
+	readTestManifest(t, filepath.Join(dir, "service.yaml"), &svc)
+	if svc.Spec.Template.Spec.Containers[0].Image != "registry.example.com/team/demo" || len(svc.Spec.Traffic) != 0 {
+		t.Fatal("base service must leave the tag and the traffic to the kustomization")
+	}
+	// The patch carries the traffic split of the base service
+	var patch servingv1.Service
+	readTestManifest(t, filepath.Join(dir, "traffic.yaml"), &patch)
+	patch.Spec.Template.Name = svc.Spec.Template.Name
+	checkExportedService(t, &patch, "")
+}
+
+func TestExportHelm(t *testing.T) {
+	cfg := exportTestConfig()
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	traffic, err := exportTraffic(cfg, "demo-v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	err = exportHelm(cfg, clusterManager, dir, traffic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var values map[string]interface{}
+	readTestManifest(t, filepath.Join(dir, "values.yaml"), &values)
+	values["secrets"] = map[string]interface{}{"db-password": "s3cr3t"}
+
+	// Templates only use the text/template subset of Helm, so they are rendered the same way
+	render := func(file string) []byte {
+		data, err := os.ReadFile(filepath.Join(dir, "templates", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl, err := template.New(file).Option("missingkey=error").Parse(string(data))
+		if err != nil {
+			t.Fatalf("%s: %v\n%s", file, err, data)
+		}
+		var out bytes.Buffer
+		err = tmpl.Execute(&out, map[string]interface{}{"Values": values})
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		return out.Bytes()
+	}
+
+	var svc servingv1.Service
+	rendered := render("service.yaml")
+	err = yaml.UnmarshalStrict(rendered, &svc)
+	if err != nil {
+		t.Fatalf("wrong service rendered: %v\n%s", err, rendered)
+	}
+	checkExportedService(t, &svc, "registry.example.com/team/demo:v1.3.0")
+
+	var secret v1.Secret
+	err = yaml.Unmarshal(render("secret-db-password.yaml"), &secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.StringData[cluster.ChillSecretKey] != "s3cr3t" {
+		t.Fatal("secret value not taken from values")
+	}
+}
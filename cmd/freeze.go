@@ -5,13 +5,12 @@ import (
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cache"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
 	"github.com/spf13/cobra"
 	"strings"
 )
 
 func RunFreeze(cmd *cobra.Command, args []string) error {
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cache"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/validate"
+)
+
+// resolveDependencies orders locked dependencies of the service, dependencies of a service always
+// go before it; the selected environment is applied to them the same way as to the service
+func resolveDependencies(cfg *service.ProjectConfig, cacheContext cache.LocalCacheContext, forceLocal bool) ([]validate.GraphNode, error) {
+	nodes, err := validate.ResolveGraph(cfg, cacheContext, forceLocal)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service specification: %w\n", err)
+	}
+	for _, node := range nodes {
+		err = node.Config.ApplyEnvironment(Environment)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", node.Config.Name, err)
+		}
+	}
+	return nodes, nil
+}
+
+// deployDependencies builds, pushes and deploys every dependency of the service
+// at its locked version, dependencies of a service always go before it
+func deployDependencies(
+	cfg *service.ProjectConfig,
+	clusterManager cluster.ClusterManager,
+	backend deployBackend,
+) error {
+	cacheContext, err := cache.DefaultCacheContext()
+	if err != nil {
+		return err
+	}
+	nodes, err := resolveDependencies(cfg, cacheContext, ForceLocal)
+	if err != nil {
+		return err
+	}
+
+	timeout := waitTimeout
+	if timeout == 0 {
+		timeout = defaultReadyTimeout
+	}
+	for _, node := range nodes {
+		depCfg := node.Config
+		live, err := backend.IsLive(depCfg)
+		if err != nil {
+			return err
+		}
+		if live {
+			fmt.Printf("Dependency %s %s is already live, skipping\n", depCfg.Name, node.Version.String())
+			continue
+		}
+
+		fmt.Printf("Deploying dependency %s %s...\n", depCfg.Name, node.Version.String())
+		// The same cache might be switched to another version by a service deployed earlier
+		err = node.Source.SwitchToVersion(cacheContext, node.Version)
+		if err != nil {
+			return fmt.Errorf("%s: unable to switch to version %s: %w", depCfg.Name, node.Version.String(), err)
+		}
+		if imageRef, pinned := depCfg.GetImageRef(ForceLocal); !pinned {
+			depCwd := node.Source.GetPath(cacheContext)
+			err = buildImage(depCwd, depCfg)
+			if err != nil {
+				return err
+			}
+			depCfg.ImageDigest, err = pushImage(depCwd, depCfg)
+			if err != nil {
+				return err
+			}
+		} else {
+			// The image has been pinned when the dependency was released
+			err = checkPinnedImage(depCfg)
+			if err != nil {
+				return fmt.Errorf("dependency %s: %w", depCfg.Name, err)
+			}
+			fmt.Printf("Using pinned image %s\n", imageRef)
+		}
+		if requireSignature {
+			err = verifyImageSignature(depCfg)
+			if err != nil {
+				return fmt.Errorf("dependency %s: %w", depCfg.Name, err)
+			}
+		}
+		// Dependents need the host of the dependency to be served already
+		err = deployService(depCfg, clusterManager, backend, nil, timeout)
+		if err != nil {
+			return fmt.Errorf("unable to deploy dependency %s: %w", depCfg.Name, err)
+		}
+	}
+	return nil
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cluster"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
 	"github.com/chill-cloud/chill-cli/pkg/integrations/remote"
 	"io/ioutil"
 	"path/filepath"
@@ -13,7 +12,7 @@ import (
 )
 
 func runIntegrateGithub(cmd *cobra.Command, args []string) error {
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
@@ -32,7 +31,7 @@ func runIntegrateGithub(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeNamespace)
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
 	if err != nil {
 		return fmt.Errorf("unable to build cluster client")
 	}
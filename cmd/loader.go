@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/spf13/cobra"
+	v1 "k8s.io/api/core/v1"
+	"os/exec"
+)
+
+const (
+	loaderMinikube = "minikube"
+	loaderKind     = "kind"
+	loaderRegistry = "registry"
+)
+
+const defaultLocalRegistry = "localhost:5000"
+
+var LocalLoader string
+var LocalRegistryAddress string
+var minikubeProfile string
+var kindCluster string
+
+// localLoader makes images built by the Docker daemon available to a local cluster
+type localLoader interface {
+	// Registry returns the prefix of image names the cluster is able to run
+	Registry() string
+	// Load makes the image available to the cluster
+	Load(imageName string) error
+	// PullPolicy tells whether the cluster has to pull the image again, since local tags are reused
+	PullPolicy() v1.PullPolicy
+}
+
+func newLocalLoader() (localLoader, error) {
+	switch LocalLoader {
+	case loaderMinikube:
+		return &minikubeLoader{profile: minikubeProfile}, nil
+	case loaderKind:
+		return &kindLoader{cluster: kindCluster}, nil
+	case loaderRegistry:
+		return &registryLoader{address: LocalRegistryAddress}, nil
+	default:
+		return nil, fmt.Errorf("unknown local loader %s", LocalLoader)
+	}
+}
+
+// resolveLocalLoader takes local cluster settings from the project config unless the flags are set
+// explicitly, then adapts names of local images to the loader
+func resolveLocalLoader(cmd *cobra.Command, cfg *service.ProjectConfig) error {
+	if cfg != nil && cfg.Local != nil {
+		if cfg.Local.Loader != "" && !cmd.Flags().Changed("local-loader") {
+			LocalLoader = cfg.Local.Loader
+		}
+		if cfg.Local.Registry != "" && !cmd.Flags().Changed("local-registry") {
+			LocalRegistryAddress = cfg.Local.Registry
+		}
+		if cfg.Local.MinikubeProfile != "" && !cmd.Flags().Changed("minikube-profile") {
+			minikubeProfile = cfg.Local.MinikubeProfile
+		}
+		if cfg.Local.KindCluster != "" && !cmd.Flags().Changed("kind-cluster") {
+			kindCluster = cfg.Local.KindCluster
+		}
+	}
+	loader, err := newLocalLoader()
+	if err != nil {
+		return err
+	}
+	service.LocalRegistry = loader.Registry()
+	return nil
+}
+
+// addLoaderFlags registers settings of loaders, which are only needed by commands loading images
+func addLoaderFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&minikubeProfile, "minikube-profile", "knative", "Minikube profile where Knative is installed to")
+	cmd.Flags().StringVar(&kindCluster, "kind-cluster", "kind", "Name of the kind cluster")
+}
+
+func runLoaderCommand(name string, args ...string) error {
+	o, err := exec.Command(name, args...).CombinedOutput()
+	logging.Logger.Info(string(o))
+	if err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", name, err, string(o))
+	}
+	return nil
+}
+
+type minikubeLoader struct {
+	profile string
+}
+
+func (l *minikubeLoader) Registry() string {
+	return service.DefaultLocalRegistry
+}
+
+func (l *minikubeLoader) PullPolicy() v1.PullPolicy {
+	return v1.PullIfNotPresent
+}
+
+func (l *minikubeLoader) Load(imageName string) error {
+	return runLoaderCommand("minikube", "-p", l.profile, "image", "load", imageName)
+}
+
+type kindLoader struct {
+	cluster string
+}
+
+func (l *kindLoader) Registry() string {
+	// Another prefix Knative does not resolve to digests by default
+	return "kind.local"
+}
+
+func (l *kindLoader) PullPolicy() v1.PullPolicy {
+	return v1.PullIfNotPresent
+}
+
+func (l *kindLoader) Load(imageName string) error {
+	return runLoaderCommand("kind", "load", "docker-image", imageName, "--name", l.cluster)
+}
+
+// registryLoader pushes images to a registry running next to the cluster without authentication;
+// Knative must not resolve its tags to digests, so the registry has to be listed in
+// registries-skipping-tag-resolving of the config-deployment config map
+type registryLoader struct {
+	address string
+}
+
+func (l *registryLoader) Registry() string {
+	return l.address
+}
+
+// PullPolicy makes nodes pull the tag pushed again, since Knative does not pin it to a digest
+func (l *registryLoader) PullPolicy() v1.PullPolicy {
+	return v1.PullAlways
+}
+
+func (l *registryLoader) Load(imageName string) error {
+	ref, err := name.NewTag(imageName)
+	if err != nil {
+		return err
+	}
+	img, err := daemon.Image(ref)
+	if err != nil {
+		return fmt.Errorf("unable to read image from the Docker daemon: %w\n", err)
+	}
+	_, err = image.Push(img, []string{imageName}, authn.Anonymous)
+	return err
+}
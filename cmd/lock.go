@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/spf13/cobra"
+	"github.com/werf/lockgate"
+	"github.com/werf/lockgate/pkg/distributed_locker"
+	"github.com/werf/werf/pkg/kubeutils"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"time"
+)
+
+// errRetryLocked might be returned from a locked action to release the lock and try again later
+var errRetryLocked = errors.New("retry under lock")
+
+var attemptsLimit int
+var sleepTime int
+var lockTimeout int
+
+func lockConfigMapName(serviceIdentifier string) string {
+	return fmt.Sprintf("chill-lock-%s", serviceIdentifier)
+}
+
+// withServiceLock runs f holding the distributed lock of the given major service
+func withServiceLock(clusterManager cluster.ClusterManager, serviceIdentifier string, f func() error) error {
+	k8sClient, err := clusterManager.GetKubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	configMapName := lockConfigMapName(serviceIdentifier)
+
+	_, err = kubeutils.GetOrCreateConfigMapWithNamespaceIfNotExists(k8sClient, KubeNamespace, configMapName)
+	if err != nil {
+		return err
+	}
+
+	lockerClient, err := clusterManager.GetLockerClient()
+
+	if err != nil {
+		return err
+	}
+
+	locker := distributed_locker.NewKubernetesLocker(
+		lockerClient, schema.GroupVersionResource{
+			Group:    "",
+			Version:  "v1",
+			Resource: "configmaps",
+		},
+		configMapName, KubeNamespace,
+	)
+
+	for i := 0; i < attemptsLimit; i++ {
+		locked, h, err := locker.Acquire("lock", lockgate.AcquireOptions{Shared: false, Timeout: time.Duration(lockTimeout) * time.Second})
+		if err != nil {
+			return err
+		}
+		if !locked {
+			logging.Logger.Info(fmt.Sprintf("Lock %d failed, waiting...", i))
+			time.Sleep(time.Duration(sleepTime) * time.Second)
+			continue
+		}
+		err = f()
+		releaseErr := locker.Release(h)
+		if releaseErr != nil {
+			// The failure of the action is what the user has to deal with first
+			if err != nil && !errors.Is(err, errRetryLocked) {
+				return fmt.Errorf("%w; unable to release the lock either: %v", err, releaseErr)
+			}
+			return fmt.Errorf("unable to release the lock: %w", releaseErr)
+		}
+		if errors.Is(err, errRetryLocked) {
+			time.Sleep(time.Duration(sleepTime) * time.Second)
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("Failed to take a lock\n")
+}
+
+func addLockFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&attemptsLimit, "attempts-limit", 5, "Number of tries to take a lock")
+	cmd.Flags().IntVar(&sleepTime, "sleep-time", 10, "Timeout between tries to take a lock")
+	cmd.Flags().IntVar(&lockTimeout, "lock-timeout", 30, "Lock timeout")
+}
@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/spf13/cobra"
+)
+
+var pruneKeep int
+
+func RunPrune(cmd *cobra.Command, args []string) error {
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	if pruneKeep < 0 {
+		return fmt.Errorf("number of kept revisions must not be negative")
+	}
+	major := cfg.CurrentVersion.GetMajor()
+	if Major != 0 {
+		major = Major
+	}
+
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return fmt.Errorf("unable to build cluster client")
+	}
+	backend, err := newDeployBackend(clusterManager)
+	if err != nil {
+		return err
+	}
+	name := clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: major})
+
+	return withServiceLock(clusterManager, name, func() error {
+		dependents, err := backend.Dependents(cfg.Name)
+		if err != nil {
+			return err
+		}
+		pinned := map[version.Version][]string{}
+		for _, d := range dependents {
+			if d.Revision != nil {
+				pinned[*d.Revision] = append(pinned[*d.Revision], d.String())
+			}
+		}
+		return backend.Prune(cfg, major, pruneKeep, pinned)
+	})
+}
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Removes old revisions which receive no traffic",
+	Long: `Removes revisions of the major deployment which receive no traffic,
+keeping the given number of the most recent ones. Revisions still used
+by live revisions of other Chill services are kept as well. With the
+kubernetes backend, deployments of idle versions are removed instead.`,
+	Args: cobra.NoArgs,
+	RunE: RunPrune,
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+
+	pruneCmd.Flags().IntVar(&pruneKeep, "keep", 2, "Number of the most recent idle revisions to keep")
+	pruneCmd.Flags().IntVarP(&Major, "major", "m", 0, "Overrides major version defined in the lock file")
+	addLockFlags(pruneCmd)
+}
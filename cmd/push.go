@@ -7,102 +7,444 @@ import (
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cluster"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
+	"github.com/chill-cloud/chill-cli/pkg/image"
 	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/progress"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/signature"
 	"github.com/docker/docker/api/types"
 	docker "github.com/docker/docker/client"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
-	"io"
 	"net/url"
-	"os/exec"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
 func RunPush(cmd *cobra.Command, args []string) error {
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
 
-	logging.Logger.Info("Creating Docker client...")
-	cli, err := docker.NewClientWithOpts(docker.FromEnv)
+	cfg, err := config.ParseConfig(cwd, config.LockConfigName, true)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return fmt.Errorf("no project config found")
+	}
+	err = cfg.ApplyEnvironment(Environment)
+	if err != nil {
+		return err
+	}
+	err = applyBuildFlags(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	var digest string
+	if daemonless {
+		digest, err = pushImageDaemonless(cwd, cfg)
+	} else {
+		digest, err = pushImage(cwd, cfg)
+	}
 	if err != nil {
-		return fmt.Errorf("unable to connect to the Docker daemon: %w\n", err)
+		return err
+	}
+	if digest == "" {
+		if pushSign {
+			return fmt.Errorf("images loaded to a local cluster cannot be signed")
+		}
+		return nil
+	}
+	if pushSign {
+		err = signImage(cfg, digest)
+		if err != nil {
+			return err
+		}
 	}
+	return recordImageDigest(cwd, digest)
+}
 
-	cfg, err := config.ParseConfig(cwd, config.LockConfigName, true)
+// signImage signs the pushed image of the current version with the local private key
+func signImage(cfg *service.ProjectConfig, digest string) error {
+	keyPath, err := homedir.Expand(signingKey)
 	if err != nil {
 		return err
 	}
-	imageName, isLocal := cfg.GetBuildTag(ForceLocal)
+	key, err := signature.LoadPrivateKey(keyPath)
+	if err != nil {
+		return err
+	}
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	ref, err := name.NewTag(imageName)
+	if err != nil {
+		return err
+	}
+	username, password, err := registryCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	err = signature.Sign(key, ref.Context().Name(), digest, &authn.Basic{Username: username, Password: password})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Image %s signed\n", digest)
+	return nil
+}
 
-	fmt.Printf("Pushing image %s...\n", imageName)
+// checkPinnedImage makes sure the registry the version is deployed from has its pinned image; the lock
+// file keeps a single digest, which might have been pushed to the registry of another environment only
+func checkPinnedImage(cfg *service.ProjectConfig) error {
+	ref, pinned := cfg.GetImageRef(ForceLocal)
+	if !pinned {
+		return nil
+	}
+	username, password, err := registryCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	exists, err := image.Exists(ref, &authn.Basic{Username: username, Password: password})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("pinned image %s not found; push the version to %s first", ref, cfg.Registry)
+	}
+	return nil
+}
+
+// verifyImageSignature makes sure the image the version is deployed with is pinned
+// and signed by one of the keys listed in the project config
+func verifyImageSignature(cfg *service.ProjectConfig) error {
+	ref, pinned := cfg.GetImageRef(ForceLocal)
+	if !pinned {
+		return fmt.Errorf("image %s is not pinned by digest, so its signature cannot be verified", ref)
+	}
+	if cfg.Signing == nil || len(cfg.Signing.PublicKeys) == 0 {
+		return fmt.Errorf("no public keys listed in the signing settings of %s", cfg.Name)
+	}
+	d, err := name.NewDigest(ref)
+	if err != nil {
+		return err
+	}
+	username, password, err := registryCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	err = signature.Verify(cfg.Signing.PublicKeys, d.Context().Name(), d.DigestStr(), &authn.Basic{Username: username, Password: password})
+	if err != nil {
+		return err
+	}
+	// Rendered manifests go to stdout in dry run mode
+	fmt.Fprintf(os.Stderr, "Signature of image %s verified\n", ref)
+	return nil
+}
 
+// registryCredentials returns the token set explicitly or the credentials stored in the cluster
+func registryCredentials(cfg *service.ProjectConfig) (string, string, error) {
+	if token != "" {
+		return "oauth2accesstoken", token, nil
+	}
+	logging.Logger.Info("No token set, trying to query from Kubernetes...")
+
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return "", "", fmt.Errorf("unable to build cluster client: %w", err)
+	}
+	var host string
+	regUrl, err := url.Parse(cfg.Registry)
+	if err != nil {
+		return "", "", err
+	}
+	if regUrl.Host == "" {
+		host = strings.Split(cfg.Registry, "/")[0]
+	} else {
+		host = regUrl.Host
+	}
+	return clusterManager.GetRegistry(cfg.Name, host)
+}
+
+// pushImageDaemonless assembles the image from a base image and artifacts or loads it
+// from a tarball, then pushes it to the registry without a Docker daemon
+func pushImageDaemonless(cwd string, cfg *service.ProjectConfig) (string, error) {
+	imageName, isLocal := cfg.GetBuildTag(ForceLocal)
 	if isLocal {
-		q := exec.Command(
-			"minikube",
-			"-p",
-			minikubeProfile,
-			"image",
-			"load",
-			imageName,
-		)
-		o, err := q.Output()
+		return "", fmt.Errorf("images cannot be loaded to a local cluster without a Docker daemon")
+	}
+	if len(cfg.GetBuild().Platforms) > 0 {
+		return "", fmt.Errorf("multi-platform images cannot be pushed without a Docker daemon")
+	}
+	if (pushTarball == "") == (pushBase == "") {
+		return "", fmt.Errorf("either a tarball or a base image must be set")
+	}
+	username, password, err := registryCredentials(cfg)
+	if err != nil {
+		return "", err
+	}
+	auth := &authn.Basic{Username: username, Password: password}
+
+	var img v1.Image
+	if pushTarball != "" {
+		var cleanup func()
+		img, cleanup, err = image.Load(pushTarball)
+		defer cleanup()
+	} else {
+		// Base images are usually public, unless they are kept next to the service image
+		var baseAuth authn.Authenticator = authn.Anonymous
+		var ref name.Reference
+		ref, err = name.ParseReference(pushBase)
 		if err != nil {
-			return err
+			return "", fmt.Errorf("wrong base image %s: %w", pushBase, err)
 		}
-		logging.Logger.Info(string(o))
-	} else {
-		username := "oauth2accesstoken"
-		if token == "" {
-			logging.Logger.Info("No token set, trying to query from Kubernetes...")
+		if strings.HasPrefix(imageName, ref.Context().RegistryStr()+"/") {
+			baseAuth = auth
+		}
+		var base v1.Image
+		base, err = image.Pull(pushBase, baseAuth)
+		if err != nil {
+			return "", err
+		}
+		artifacts := pushArtifacts
+		if !filepath.IsAbs(artifacts) {
+			artifacts = filepath.Join(cwd, artifacts)
+		}
+		img, err = image.Assemble(base, artifacts, pushArtifactsPath)
+	}
+	if err != nil {
+		return "", err
+	}
+	img, err = image.WithLabels(img, imageLabels(cwd, cfg))
+	if err != nil {
+		return "", err
+	}
+	return pushToRegistry(cfg, img, auth)
+}
 
-			clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeNamespace)
-			if err != nil {
-				return fmt.Errorf("unable to build cluster client: %w", err)
-			}
-			var host string
-			regUrl, err := url.Parse(cfg.Registry)
-			if err != nil {
-				return err
-			}
-			if regUrl.Host == "" {
-				host = strings.Split(cfg.Registry, "/")[0]
-			} else {
-				host = regUrl.Host
+// pushWithProgress pushes the artifact reporting progress to updates, which is closed afterwards
+// in any case: the registry client closes its channel only if the upload has got to start
+func pushWithProgress(img image.Artifact, tags []string, auth authn.Authenticator, updates chan<- v1.Update) (string, error) {
+	sent := make(chan v1.Update)
+	done := make(chan struct{})
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		defer close(updates)
+		for {
+			select {
+			case u, ok := <-sent:
+				if !ok {
+					return
+				}
+				updates <- u
+			case <-done:
+				// Sends are unbuffered, so none is left once the push has returned
+				return
 			}
+		}
+	}()
+	pushed, err := image.Push(img, tags, auth, remote.WithProgress(sent))
+	close(done)
+	<-forwarded
+	return pushed, err
+}
 
-			username, token, err = clusterManager.GetRegistry(cfg.Name, host)
-			if err != nil {
-				return err
-			}
+// pushToRegistry uploads the image or the index under all its tags and returns its digest;
+// the version tag is not moved to a different image unless forced
+func pushToRegistry(cfg *service.ProjectConfig, img image.Artifact, auth authn.Authenticator) (string, error) {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	digest, err := img.Digest()
+	if err != nil {
+		return "", err
+	}
+	existing, err := image.RemoteDigest(imageName, auth)
+	if err != nil {
+		return "", err
+	}
+	if existing != "" && existing != digest.String() {
+		if !forcePush {
+			return "", fmt.Errorf("image %s already exists with digest %s; use --force to overwrite it", imageName, existing)
 		}
-		authConfig := types.AuthConfig{
-			Username: username,
-			Password: token,
+		fmt.Printf("WARNING! Overwriting image %s with digest %s\n", imageName, existing)
+	}
+	tags, err := imageTags(imageName, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Pushing image %s...\n", imageName)
+	updates := make(chan v1.Update, 16)
+	rendered := make(chan error, 1)
+	go func() {
+		rendered <- progress.RenderUpdates(imageName, "Pushing", updates, os.Stdout)
+	}()
+	pushed, err := pushWithProgress(img, tags, auth, updates)
+	if err != nil {
+		return "", err
+	}
+	// Push only succeeds if the upload has not reported an error
+	if err = <-rendered; err != nil {
+		return "", fmt.Errorf("unable to push image %s: %w", imageName, err)
+	}
+	fmt.Printf("Image pushed successfully with digest %s\n", pushed)
+	return pushed, nil
+}
+
+// pushImage pushes the built image of the service to its registry and returns its digest, unless
+// the registry has the image built from the same context already; images built for several
+// platforms are pushed as an index. Images loaded to a local cluster have no digest
+func pushImage(cwd string, cfg *service.ProjectConfig) (string, error) {
+	imageName, isLocal := cfg.GetBuildTag(ForceLocal)
+
+	if isLocal {
+		loader, err := newLocalLoader()
+		if err != nil {
+			return "", err
 		}
-		encodedJSON, err := json.Marshal(authConfig)
+		fmt.Printf("Loading image %s to the local cluster...\n", imageName)
+		err = loader.Load(imageName)
 		if err != nil {
-			return fmt.Errorf("error when encoding authConfig. err: %w", err)
+			return "", err
 		}
+		fmt.Println("Image loaded successfully!")
+		return "", nil
+	}
 
-		authStr := base64.URLEncoding.EncodeToString(encodedJSON)
-		pushResp, err := cli.ImagePush(context.TODO(), imageName, types.ImagePushOptions{
-			All:          true,
-			RegistryAuth: authStr,
-		})
+	platforms := buildPlatforms(cfg)
+	hash, err := contextHash(cwd, cfg, platforms...)
+	if err != nil {
+		return "", err
+	}
+	username, password, err := registryCredentials(cfg)
+	if err != nil {
+		return "", err
+	}
+	auth := &authn.Basic{Username: username, Password: password}
+	digest, err := remoteImageUpToDate(cfg, hash, auth)
+	if err != nil {
+		return "", err
+	}
+	if digest != "" {
+		fmt.Printf("Image %s is up to date in the registry with digest %s\n", imageName, digest)
+		return digest, nil
+	}
+
+	if len(platforms) == 0 {
+		return pushFromDaemon(cfg, username, password)
+	}
+	images, err := platformImages(cwd, cfg)
+	if err != nil {
+		return "", err
+	}
+	var built []v1.Image
+	for _, pi := range images {
+		ref, err := name.NewTag(pi.tags[0])
 		if err != nil {
-			return fmt.Errorf("Unable to push image: %w\n", err)
+			return "", err
 		}
-		var out strings.Builder
-		_, err = io.Copy(&out, pushResp)
+		// The index is assembled from images exported from the daemon
+		img, err := daemon.Image(ref)
 		if err != nil {
-			return err
+			return "", fmt.Errorf("unable to read image %s from the Docker daemon: %w\n", pi.tags[0], err)
 		}
-		println(out.String())
+		built = append(built, img)
 	}
-	fmt.Printf("Image pushed successfully!")
-	return nil
+	idx, err := image.Index(built, platforms, map[string]string{image.ContextHashLabel: hash})
+	if err != nil {
+		return "", err
+	}
+	return pushToRegistry(cfg, idx, auth)
+}
+
+// pushFromDaemon pushes the built image with all its tags from the Docker daemon and returns the digest
+// the daemon reports for the version tag; the version tag is not moved to a different image unless forced
+func pushFromDaemon(cfg *service.ProjectConfig, username string, password string) (string, error) {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	ref, err := name.NewTag(imageName)
+	if err != nil {
+		return "", err
+	}
+	logging.Logger.Info("Creating Docker client...")
+	cli, err := docker.NewClientWithOpts(docker.FromEnv)
+	if err != nil {
+		return "", fmt.Errorf("unable to connect to the Docker daemon: %w\n", err)
+	}
+	ctx := context.Background()
+
+	existing, err := image.RemoteDigest(imageName, &authn.Basic{Username: username, Password: password})
+	if err != nil {
+		return "", err
+	}
+	if existing != "" {
+		inspect, _, err := cli.ImageInspectWithRaw(ctx, imageName)
+		if err != nil {
+			return "", fmt.Errorf("unable to inspect image %s: %w\n", imageName, err)
+		}
+		// The daemon records digests of the images it has pushed or pulled
+		same := false
+		for _, d := range inspect.RepoDigests {
+			same = same || d == ref.Context().Name()+"@"+existing
+		}
+		if !same {
+			if !forcePush {
+				return "", fmt.Errorf("image %s already exists with digest %s; use --force to overwrite it", imageName, existing)
+			}
+			fmt.Printf("WARNING! Overwriting image %s with digest %s\n", imageName, existing)
+		}
+	}
+
+	authConfig := types.AuthConfig{
+		Username: username,
+		Password: password,
+	}
+	encodedJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", fmt.Errorf("error when encoding authConfig. err: %w", err)
+	}
+	authStr := base64.URLEncoding.EncodeToString(encodedJSON)
+
+	fmt.Printf("Pushing image %s...\n", imageName)
+	pushResp, err := cli.ImagePush(ctx, imageName, types.ImagePushOptions{
+		All:          true,
+		RegistryAuth: authStr,
+	})
+	if err != nil {
+		return "", fmt.Errorf("Unable to push image: %w\n", err)
+	}
+	defer pushResp.Close()
+	digests, err := progress.RenderPush(pushResp, os.Stdout)
+	if err != nil {
+		return "", fmt.Errorf("unable to push image %s: %w", imageName, err)
+	}
+	digest, ok := digests[ref.TagStr()]
+	if !ok {
+		return "", fmt.Errorf("no digest reported by the Docker daemon for image %s", imageName)
+	}
+	fmt.Printf("Image pushed successfully with digest %s\n", digest)
+	return digest, nil
+}
+
+// recordImageDigest pins the pushed image of the current version in the lock file
+func recordImageDigest(cwd string, digest string) error {
+	lockCfg, err := config.ParseConfig(cwd, config.LockConfigName, true)
+	if err != nil {
+		return err
+	}
+	if lockCfg == nil {
+		return fmt.Errorf("no project config found")
+	}
+	lockCfg.ImageDigest = digest
+	s, err := config.ProcessConfig(lockCfg)
+	if err != nil {
+		return err
+	}
+	return s.SaveToFile(filepath.Join(cwd, config.LockConfigName), true)
 }
 
 // pushCmd represents the push command
@@ -118,22 +460,36 @@ to quickly create a Cobra application.`,
 	RunE: RunPush,
 }
 
-var minikubeProfile string
 var token string
+var daemonless bool
+var forcePush bool
+var pushBase string
+var pushArtifacts string
+var pushArtifactsPath string
+var pushTarball string
+var pushSign bool
+var signingKey string
 
 func init() {
 	rootCmd.AddCommand(pushCmd)
 
-	deployCmd.Flags().StringVar(
-		&minikubeProfile,
-		"minikube-profile",
-		"knative",
-		"Minikube profile where Knative is installed to")
-
-	deployCmd.Flags().StringVarP(
-		&token,
-		"token",
-		"t",
-		"",
-		"Registry OAuth token (will be queried from Kubernetes if not set)")
+	addLoaderFlags(pushCmd)
+	for _, c := range []*cobra.Command{pushCmd, deployCmd} {
+		// Deploy pushes images of dependencies
+		c.Flags().StringVarP(
+			&token,
+			"token",
+			"t",
+			"",
+			"Registry OAuth token (will be queried from Kubernetes if not set)")
+	}
+
+	pushCmd.Flags().BoolVar(&forcePush, "force", false, "Overwrite the image of the version even if its digest differs")
+	pushCmd.Flags().BoolVar(&daemonless, "daemonless", false, "Push the image without a Docker daemon")
+	pushCmd.Flags().StringVar(&pushBase, "base", "", "Base image the artifacts are added to (daemonless mode)")
+	pushCmd.Flags().StringVar(&pushArtifacts, "artifacts", "build", "Directory with built artifacts (daemonless mode)")
+	pushCmd.Flags().StringVar(&pushArtifactsPath, "artifacts-path", "/app", "Path of the artifacts in the image (daemonless mode)")
+	pushCmd.Flags().BoolVar(&pushSign, "sign", false, "Sign the pushed image with the local private key")
+	pushCmd.Flags().StringVar(&signingKey, "signing-key", filepath.Join("~", ".chill", "signing.key"), "PKCS #8 PEM encoded ed25519 private key used to sign images")
+	pushCmd.Flags().StringVar(&pushTarball, "tarball", "", "OCI layout or docker save tarball to push (daemonless mode)")
 }
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/image/imagetest"
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDaemonlessPushMissingArtifacts(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+	base, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseRef := host + "/base:latest"
+	_, err = image.Push(base, []string{baseRef}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, pushBase, pushTarball = "test", baseRef, ""
+	pushArtifacts = "missing"
+	defer func() {
+		token, pushBase, pushArtifacts = "", "", "build"
+	}()
+	cfg := imagetest.ProjectConfig(host)
+	cwd := t.TempDir()
+	_, err = pushImageDaemonless(cwd, cfg)
+	if err == nil {
+		t.Fatal("missing artifacts directory accepted")
+	}
+	if !strings.Contains(err.Error(), filepath.Join(cwd, "missing")) {
+		t.Fatalf("error does not point at the artifacts directory: %v", err)
+	}
+}
+
+func TestPushWithProgressClosesUpdates(t *testing.T) {
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := make(chan v1.Update, 16)
+	// The tag is rejected before the registry client gets the channel
+	_, err = pushWithProgress(img, []string{"wrong tag"}, authn.Anonymous, updates)
+	if err == nil {
+		t.Fatal("wrong tag accepted")
+	}
+	for range updates {
+	}
+}
@@ -0,0 +1,292 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cache"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/spf13/cobra"
+	"sort"
+	"strings"
+)
+
+var gcKeep int
+var gcDryRun bool
+
+// gcTargets returns the cluster target of the flags along with the ones of every environment
+// declared in the project config
+func gcTargets(cmd *cobra.Command, cfg *service.ProjectConfig) []clusterTarget {
+	base := flagTarget(cmd)
+	res := []clusterTarget{base}
+	seen := map[clusterTarget]bool{base: true}
+	var envs []string
+	for env := range cfg.Environments {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	for _, env := range envs {
+		e := cfg.Environments[env]
+		t := environmentTarget(cmd, base, &e)
+		if !seen[t] {
+			seen[t] = true
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+// withClusterTarget runs f with the global cluster flags pointing to the target
+func withClusterTarget(t clusterTarget, f func() error) error {
+	kubeContext, namespace, backend := KubeContext, KubeNamespace, Backend
+	defer func() {
+		KubeContext, KubeNamespace, Backend = kubeContext, namespace, backend
+	}()
+	KubeContext, KubeNamespace, Backend = t.kubeContext, t.namespace, t.backend
+	return f()
+}
+
+// liveVersions returns versions deployed to any of the targets; a target which cannot be
+// queried fails the whole lookup, as its versions might still be in use
+func liveVersions(cfg *service.ProjectConfig, targets []clusterTarget, majors map[int]bool) (map[version.Version]bool, error) {
+	res := map[version.Version]bool{}
+	for _, t := range targets {
+		err := withClusterTarget(t, func() error {
+			clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+			if err != nil {
+				return fmt.Errorf("unable to build cluster client")
+			}
+			backend, err := newDeployBackend(clusterManager)
+			if err != nil {
+				return err
+			}
+			for major := range majors {
+				live, err := backend.LiveVersions(cfg, major)
+				if err != nil {
+					return err
+				}
+				for v := range live {
+					res[v] = true
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to find versions deployed to namespace %s (context %q, %s backend): %w",
+				t.namespace, t.kubeContext, t.backend, err)
+		}
+	}
+	return res, nil
+}
+
+func RunRegistryGc(cmd *cobra.Command, args []string) error {
+	cwd, err := setupProjectDir()
+	if err != nil {
+		return err
+	}
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	err = cfg.ApplyEnvironment(Environment)
+	if err != nil {
+		return err
+	}
+	if gcKeep < 0 {
+		return fmt.Errorf("number of kept versions must not be negative")
+	}
+	imageName, isLocal := cfg.GetBuildTag(false)
+	if isLocal {
+		return fmt.Errorf("no registry set for the service")
+	}
+	tag, err := name.NewTag(imageName)
+	if err != nil {
+		return err
+	}
+	repository := tag.Context().Name()
+	username, password, err := registryCredentials(cfg)
+	if err != nil {
+		return err
+	}
+	auth := &authn.Basic{Username: username, Password: password}
+
+	tags, err := image.ListTags(repository, auth)
+	if err != nil {
+		return err
+	}
+	versionTags := map[version.Version][]string{}
+	var otherTags []string
+	signatures := map[string]string{}
+	for _, t := range tags {
+		if v := image.VersionOfTag(t); v != nil {
+			versionTags[*v] = append(versionTags[*v], t)
+		} else if strings.HasSuffix(t, ".sig") {
+			// Signatures are found by digests of the images they are made for
+			signatures[strings.Replace(strings.TrimSuffix(t, ".sig"), "-", ":", 1)] = t
+		} else {
+			otherTags = append(otherTags, t)
+		}
+	}
+
+	s, err := cache.NewLocalSourceOfTruth(cwd)
+	if err != nil {
+		return err
+	}
+	frozen, err := s.GetVersions()
+	if err != nil {
+		return err
+	}
+	protected := map[version.Version]bool{*cfg.CurrentVersion: true}
+	for _, v := range frozen {
+		protected[v] = true
+	}
+	var versions []version.Version
+	majors := map[int]bool{}
+	for v := range versionTags {
+		versions = append(versions, v)
+		majors[v.GetMajor()] = true
+	}
+	live, err := liveVersions(cfg, gcTargets(cmd, cfg), majors)
+	if err != nil {
+		return err
+	}
+	for v := range live {
+		protected[v] = true
+	}
+
+	superseded := image.SupersededVersions(versions, protected, gcKeep)
+	if len(superseded) == 0 {
+		println("Nothing to delete")
+		return nil
+	}
+	removed := map[version.Version]bool{}
+	for _, v := range superseded {
+		removed[v] = true
+	}
+
+	// A digest is only deleted if no kept tag points to it, as deleting it removes all its tags
+	keptTags := otherTags
+	for v, vTags := range versionTags {
+		if !removed[v] {
+			keptTags = append(keptTags, vTags...)
+		}
+	}
+	keptDigests := map[string]bool{}
+	for _, t := range keptTags {
+		ref := fmt.Sprintf("%s:%s", repository, t)
+		digest, err := image.RemoteDigest(ref, auth)
+		if err != nil {
+			return err
+		}
+		keptDigests[digest] = true
+		children, err := image.Children(ref, auth)
+		if err != nil {
+			return err
+		}
+		for _, c := range children {
+			keptDigests[c] = true
+		}
+	}
+
+	for _, v := range superseded {
+		vTags := versionTags[v]
+		sort.Strings(vTags)
+		for _, t := range vTags {
+			ref := fmt.Sprintf("%s:%s", repository, t)
+			digest, err := image.RemoteDigest(ref, auth)
+			if err != nil {
+				return err
+			}
+			if digest == "" {
+				// Deleted along with another tag of the same image
+				continue
+			}
+			if keptDigests[digest] {
+				fmt.Printf("Keeping %s, its image is referenced by a kept tag\n", ref)
+				continue
+			}
+			refs := []string{ref}
+			signature, signed := signatures[digest]
+			if signed {
+				refs = append(refs, fmt.Sprintf("%s:%s", repository, signature))
+			}
+			// Platform images of an index are untagged, so they are deleted by their digests
+			children, err := image.Children(ref, auth)
+			if err != nil {
+				return err
+			}
+			var platformDigests []string
+			for _, c := range children {
+				if !keptDigests[c] {
+					platformDigests = append(platformDigests, c)
+				}
+			}
+			if gcDryRun {
+				fmt.Printf("Would delete %s (%s)\n", strings.Join(refs, ", "), digest)
+				for _, c := range platformDigests {
+					fmt.Printf("Would delete platform image %s@%s\n", repository, c)
+				}
+				continue
+			}
+			// The index goes first, as registries might refuse to delete images it references
+			err = image.Delete(repository, digest, []string{t}, auth)
+			if err != nil {
+				return err
+			}
+			for _, c := range platformDigests {
+				err = image.Delete(repository, c, nil, auth)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Deleted platform image %s@%s\n", repository, c)
+			}
+			if signed {
+				sigDigest, err := image.RemoteDigest(refs[1], auth)
+				if err != nil {
+					return err
+				}
+				if sigDigest != "" {
+					err = image.Delete(repository, sigDigest, []string{signature}, auth)
+					if err != nil {
+						return err
+					}
+				}
+			}
+			fmt.Printf("Deleted %s (%s)\n", strings.Join(refs, ", "), digest)
+		}
+	}
+	return nil
+}
+
+// registryCmd represents the registry command
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "Manages images of the service in its registry",
+}
+
+var registryGcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Deletes images of superseded development versions",
+	Long: `Lists tags of the service repository in the registry and deletes images
+of development versions, along with their platform images and signatures.
+Production versions, versions frozen with chill-* git tags, the current
+version and versions deployed to the cluster are never deleted. Deployed
+versions are looked up with the backend of the flags and with the one of
+every environment declared in the project config; gc fails if any of them
+cannot be queried. Of the remaining development versions, the newest ones
+of every minor version are kept.`,
+	Args: cobra.NoArgs,
+	RunE: RunRegistryGc,
+}
+
+func init() {
+	rootCmd.AddCommand(registryCmd)
+
+	registryCmd.AddCommand(registryGcCmd)
+
+	registryGcCmd.Flags().IntVar(&gcKeep, "keep", 2, "Number of the newest development versions of every minor version to keep")
+	registryGcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Only list images which would be deleted")
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/config"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/chill-cloud/chill-cli/pkg/version/constraint"
+	"github.com/chill-cloud/chill-cli/pkg/version/set"
+	"github.com/spf13/cobra"
+)
+
+func RunRollback(cmd *cobra.Command, args []string) error {
+	cwd, err := setupProjectDir()
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.ParseConfig(cwd, config.LockConfigName, true)
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return fmt.Errorf("no project config found")
+	}
+
+	var target *version.Version
+	major := cfg.CurrentVersion.GetMajor()
+	if len(args) > 0 {
+		target, err = version.ParseFromString(args[0])
+		if err != nil {
+			return err
+		}
+		if !version.IsProduction(*target) {
+			return fmt.Errorf("only production versions might receive traffic")
+		}
+		major = target.GetMajor()
+	}
+
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return fmt.Errorf("unable to build cluster client")
+	}
+	backend, err := newDeployBackend(clusterManager)
+	if err != nil {
+		return err
+	}
+	name := clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: major})
+
+	return withServiceLock(clusterManager, name, func() error {
+		traffic, err := backend.Traffic(cfg, major)
+		if err != nil {
+			return err
+		}
+
+		var current *version.Version
+		var currentPercent int64
+		var versions []version.Version
+		for v, t := range traffic {
+			v := v
+			versions = append(versions, v)
+			if t.Percent > 0 && (current == nil || t.Percent > currentPercent ||
+				t.Percent == currentPercent && v.Compare(*current) > 0) {
+				current = &v
+				currentPercent = t.Percent
+			}
+		}
+
+		verset := set.ArrayVersionSet(versions)
+		if target == nil {
+			if current == nil {
+				return fmt.Errorf("no revision receives traffic, specify the version explicitly")
+			}
+			target = verset.GetLatestVersion(constraint.NewMinorOnly(constraint.New(
+				version.Version{Major: major, Minor: 0, Patch: 0},
+				*current,
+			)))
+			if target == nil {
+				return fmt.Errorf("no production version deployed before %s", current.String())
+			}
+		} else if _, ok := traffic[*target]; !ok {
+			return fmt.Errorf("version %s has never been deployed", target.String())
+		}
+
+		err = backend.SetTraffic(cfg, major, map[version.Version]int64{*target: 100})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Traffic switched to version %s\n", target.String())
+		return nil
+	})
+}
+
+// rollbackCmd represents the rollback command
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [version]",
+	Short: "Routes all the traffic back to a previously deployed version",
+	Long: `Routes all the traffic of the major deployment to the given production
+version, or to the latest production version preceding the one
+currently receiving the most of the traffic. No image is rebuilt
+or pushed, only the route of the service is changed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: RunRollback,
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+
+	addLockFlags(rollbackCmd)
+}
@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"errors"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/config"
+	cwd2 "github.com/chill-cloud/chill-cli/pkg/cwd"
 	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/service"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -20,6 +25,103 @@ var Cwd string
 var Kubeconfig string
 var KubeNamespace string
 var ForceLocal bool
+var KubeContext string
+var Environment string
+var Backend string
+
+// clusterTarget is where services are deployed to
+type clusterTarget struct {
+	kubeContext string
+	namespace   string
+	backend     string
+}
+
+// flagTarget returns the cluster target set by the flags, before any environment is applied
+func flagTarget(cmd *cobra.Command) clusterTarget {
+	value := func(name string) string {
+		f := cmd.Flags().Lookup(name)
+		if f.Changed {
+			return f.Value.String()
+		}
+		return f.DefValue
+	}
+	return clusterTarget{
+		kubeContext: value("kube-context"),
+		namespace:   value("kube-namespace"),
+		backend:     value("backend"),
+	}
+}
+
+// environmentTarget overrides the cluster target by settings of the environment; flags set
+// explicitly take precedence
+func environmentTarget(cmd *cobra.Command, t clusterTarget, e *service.Environment) clusterTarget {
+	if e.KubeContext != "" && !cmd.Flags().Changed("kube-context") {
+		t.kubeContext = e.KubeContext
+	}
+	if e.Namespace != "" && !cmd.Flags().Changed("kube-namespace") {
+		t.namespace = e.Namespace
+	}
+	if e.Backend != "" && !cmd.Flags().Changed("backend") {
+		t.backend = e.Backend
+	}
+	return t
+}
+
+// resolveEnvironment takes cluster settings of the selected environment from the project config
+func resolveEnvironment(cmd *cobra.Command, cfg *service.ProjectConfig) error {
+	if Environment == "" {
+		return nil
+	}
+	if cfg == nil {
+		return fmt.Errorf("no project config found")
+	}
+	// Only dependencies fall back to the default environment
+	if _, ok := cfg.Environments[Environment]; !ok {
+		return fmt.Errorf("unknown environment %s", Environment)
+	}
+	e, err := cfg.GetEnvironment(Environment)
+	if err != nil {
+		return err
+	}
+	t := environmentTarget(cmd, flagTarget(cmd), e)
+	KubeContext, KubeNamespace, Backend = t.kubeContext, t.namespace, t.backend
+	return nil
+}
+
+// projectDir is the project directory found before running the command, empty outside of a project
+var projectDir string
+
+// setupProjectDir returns the project directory, failing outside of a project
+func setupProjectDir() (string, error) {
+	if projectDir != "" {
+		return projectDir, nil
+	}
+	return cwd2.SetupCwd(Cwd)
+}
+
+// resolveProjectSettings applies settings of the project config, if there is one, to the global flags;
+// commands working outside of a project, like create, are run with the flags as they are
+func resolveProjectSettings(cmd *cobra.Command) error {
+	var cfg *service.ProjectConfig
+	cwd, err := cwd2.SetupCwd(Cwd)
+	switch {
+	case errors.Is(err, cwd2.ErrNoProject):
+		logging.Logger.Info("No project found, project settings are not applied")
+	case err != nil:
+		return err
+	default:
+		projectDir = cwd
+		cfg, err = config.ParseConfig(cwd, config.ProjectConfigName, false)
+		if err != nil {
+			return err
+		}
+	}
+	err = resolveEnvironment(cmd, cfg)
+	if err != nil {
+		return err
+	}
+	return resolveLocalLoader(cmd, cfg)
+}
 
 func Execute() {
 	err := rootCmd.Execute()
@@ -49,11 +151,16 @@ func init() {
 			}
 		}()
 		logging.Logger.Info("Verbose logging enabled")
-		return nil
+		return resolveProjectSettings(cmd)
 	}
 	rootCmd.PersistentFlags().BoolVarP(&v, "verbose", "v", false, "Enable detailed logging")
 	rootCmd.PersistentFlags().BoolVarP(&ForceLocal, "local", "l", false, "Force enable local mode")
 	rootCmd.PersistentFlags().StringVar(&Cwd, "cwd", "", "Force set project directory")
 	rootCmd.PersistentFlags().StringVar(&Kubeconfig, "kubeconfig", "", "Set the kubeconfig path")
+	rootCmd.PersistentFlags().StringVar(&KubeContext, "kube-context", "", "Set the kubeconfig context, the current one by default")
 	rootCmd.PersistentFlags().StringVar(&KubeNamespace, "kube-namespace", v1.NamespaceDefault, "Set the Kubernetes namespace")
+	rootCmd.PersistentFlags().StringVar(&Backend, "backend", backendKnative, "Set the deployment backend (knative or kubernetes)")
+	rootCmd.PersistentFlags().StringVar(&Environment, "env", "", "Select the environment declared in the project config")
+	rootCmd.PersistentFlags().StringVar(&LocalLoader, "local-loader", loaderMinikube, "Set the way images reach a local cluster (minikube, kind or registry)")
+	rootCmd.PersistentFlags().StringVar(&LocalRegistryAddress, "local-registry", defaultLocalRegistry, "Set the address of the local registry used by the registry loader")
 }
@@ -0,0 +1,271 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cache"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/service/naming"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const composeNetwork = "chill"
+
+var runComposeFile string
+var runSecretsDir string
+var runPort int
+var runNoUp bool
+
+// composeService describes a container of the local run
+type composeService struct {
+	Image       string                         `json:"image"`
+	Hostname    string                         `json:"hostname"`
+	Environment map[string]string              `json:"environment,omitempty"`
+	EnvFile     []string                       `json:"env_file,omitempty"`
+	Volumes     []string                       `json:"volumes,omitempty"`
+	Ports       []string                       `json:"ports,omitempty"`
+	DependsOn   []string                       `json:"depends_on,omitempty"`
+	Networks    map[string]map[string][]string `json:"networks"`
+}
+
+type composeFile struct {
+	Name     string                            `json:"name"`
+	Services map[string]composeService         `json:"services"`
+	Networks map[string]map[string]interface{} `json:"networks"`
+}
+
+// composeEscape keeps compose from interpolating variables in values
+func composeEscape(value string) string {
+	return strings.ReplaceAll(value, "$", "$$")
+}
+
+// buildComposeService runs the version of the service the same way the cluster would: dependencies
+// are reachable by their in-cluster hosts, secrets are read from the local secrets directory and
+// passed through an env file written there; the service is only reachable by the host of its
+// version, see addMajorAliases
+func buildComposeService(
+	cfg *service.ProjectConfig,
+	clusterManager cluster.ClusterManager,
+	runDir string,
+	secretsDir string,
+) (string, *composeService, error) {
+	imageName, _ := cfg.GetBuildTag(true)
+	path := clusterManager.GetRevisionPath(cfg.Name, *cfg.CurrentVersion)
+	env := map[string]string{
+		"CHILL_SELF_NAME":    cfg.Name,
+		"CHILL_SELF_VERSION": cfg.CurrentVersion.String(),
+	}
+
+	var dependsOn []string
+	for dep := range cfg.Dependencies {
+		specificVersion := dep.GetSpecificVersion()
+		if specificVersion == nil {
+			return "", nil, fmt.Errorf("specific version must be set for service %s", dep.GetName())
+		}
+		host, err := clusterManager.GetInternalServiceHost(dep.GetName(), *specificVersion, dep.GetVersion())
+		if err != nil {
+			return "", nil, err
+		}
+		env[naming.NameToEnv(dep.GetName())] = host
+		dependsOn = append(dependsOn, clusterManager.GetRevisionPath(dep.GetName(), *specificVersion))
+	}
+	sort.Strings(dependsOn)
+
+	var volumes, envFiles, secretEnv []string
+	for _, s := range cfg.Secrets {
+		secretPath := filepath.Join(secretsDir, s)
+		value, err := os.ReadFile(secretPath)
+		if err != nil {
+			return "", nil, fmt.Errorf("unable to read secret %s of service %s: %w", s, cfg.Name, err)
+		}
+		// Secret files usually end with a newline the value set in the cluster does not have
+		trimmed := strings.TrimSuffix(string(value), "\n")
+		// Single quoted values are taken as is, but there is no way to escape the quote itself
+		if strings.Contains(trimmed, "'") {
+			return "", nil, fmt.Errorf("secret %s of service %s contains a single quote, which env files cannot hold", s, cfg.Name)
+		}
+		secretEnv = append(secretEnv, fmt.Sprintf("%s='%s'\n", naming.SecretToEnv(s), trimmed))
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro",
+			secretPath,
+			filepath.Join(naming.SecretToMountPath(s), cluster.ChillSecretKey),
+		))
+	}
+	if len(secretEnv) > 0 {
+		// Values stay next to the secret files instead of being copied to the compose file
+		envFile := filepath.Join(secretsDir, "."+path+".env")
+		err := os.WriteFile(envFile, []byte(strings.Join(secretEnv, "")), 0600)
+		if err != nil {
+			return "", nil, err
+		}
+		envFiles = append(envFiles, envFile)
+	}
+
+	values, err := cfg.GetConfig(Environment)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(values) > 0 {
+		configDir := filepath.Join(runDir, "config", path)
+		err = os.MkdirAll(configDir, os.ModePerm)
+		if err != nil {
+			return "", nil, err
+		}
+		for k, v := range values {
+			env[k] = composeEscape(v)
+			err = os.WriteFile(filepath.Join(configDir, k), []byte(v), 0644)
+			if err != nil {
+				return "", nil, err
+			}
+		}
+		volumes = append(volumes, fmt.Sprintf("%s:%s:ro", configDir, naming.ConfigMountPath))
+	}
+
+	aliases := []string{fmt.Sprintf("%s.%s.svc.cluster.local", path, KubeNamespace)}
+	return path, &composeService{
+		Image:       imageName,
+		Hostname:    path,
+		Environment: env,
+		EnvFile:     envFiles,
+		Volumes:     volumes,
+		DependsOn:   dependsOn,
+		Networks:    map[string]map[string][]string{composeNetwork: {"aliases": aliases}},
+	}, nil
+}
+
+// addMajorAliases makes the latest version of every major reachable by the host of the whole major
+// deployment, the way the cluster routes to it; several versions of a major might be in the graph
+func addMajorAliases(compose *composeFile, clusterManager cluster.ClusterManager, configs []*service.ProjectConfig) {
+	latest := map[string]*service.ProjectConfig{}
+	for _, cfg := range configs {
+		identifier := clusterManager.GetServiceIdentifier(cfg.Name, *cfg.CurrentVersion)
+		if l, ok := latest[identifier]; !ok || l.CurrentVersion.Compare(*cfg.CurrentVersion) < 0 {
+			latest[identifier] = cfg
+		}
+	}
+	for identifier, cfg := range latest {
+		name := clusterManager.GetRevisionPath(cfg.Name, *cfg.CurrentVersion)
+		s := compose.Services[name]
+		network := s.Networks[composeNetwork]
+		network["aliases"] = append(network["aliases"], fmt.Sprintf("%s.%s.svc.cluster.local", identifier, KubeNamespace))
+		compose.Services[name] = s
+	}
+}
+
+func RunRun(cmd *cobra.Command, args []string) error {
+	cwd, err := setupProjectDir()
+	if err != nil {
+		return err
+	}
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	err = cfg.ApplyEnvironment(Environment)
+	if err != nil {
+		return err
+	}
+	// Images never leave the local Docker daemon
+	ForceLocal = true
+
+	cacheContext, err := cache.DefaultCacheContext()
+	if err != nil {
+		return err
+	}
+	nodes, err := resolveDependencies(cfg, cacheContext, false)
+	if err != nil {
+		return err
+	}
+
+	composePath := runComposeFile
+	if !filepath.IsAbs(composePath) {
+		composePath = filepath.Join(cwd, composePath)
+	}
+	runDir := filepath.Dir(composePath)
+	secretsDir := runSecretsDir
+	if !filepath.IsAbs(secretsDir) {
+		secretsDir = filepath.Join(cwd, secretsDir)
+	}
+	err = os.MkdirAll(runDir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	compose := composeFile{
+		Name:     fmt.Sprintf("chill-%s", cfg.Name),
+		Services: map[string]composeService{},
+		Networks: map[string]map[string]interface{}{composeNetwork: {}},
+	}
+	var configs []*service.ProjectConfig
+	for _, node := range nodes {
+		fmt.Printf("Building dependency %s %s...\n", node.Config.Name, node.Version.String())
+		err = node.Source.SwitchToVersion(cacheContext, node.Version)
+		if err != nil {
+			return fmt.Errorf("%s: unable to switch to version %s: %w", node.Config.Name, node.Version.String(), err)
+		}
+		err = buildImage(node.Source.GetPath(cacheContext), node.Config)
+		if err != nil {
+			return err
+		}
+		name, s, err := buildComposeService(node.Config, clusterManager, runDir, secretsDir)
+		if err != nil {
+			return err
+		}
+		compose.Services[name] = *s
+		configs = append(configs, node.Config)
+	}
+
+	err = buildImage(cwd, cfg)
+	if err != nil {
+		return err
+	}
+	name, s, err := buildComposeService(cfg, clusterManager, runDir, secretsDir)
+	if err != nil {
+		return err
+	}
+	s.Ports = []string{fmt.Sprintf("%d:%d", runPort, servicePort)}
+	compose.Services[name] = *s
+	addMajorAliases(&compose, clusterManager, append(configs, cfg))
+
+	err = writeManifest(composePath, compose)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Compose file written to %s\n", composePath)
+	if runNoUp {
+		return nil
+	}
+
+	q := exec.Command("docker", "compose", "-f", composePath, "up", "--remove-orphans")
+	q.Stdin = os.Stdin
+	q.Stdout = os.Stdout
+	q.Stderr = os.Stderr
+	return q.Run()
+}
+
+// runCmd represents the run command
+var runCmd = &cobra.Command{
+	Use:   "run",
+	Short: "Runs the service locally along with its dependencies",
+	Long: `Builds the service and all its dependencies at their locked versions,
+then starts them as local containers on a shared Docker network using
+a generated compose file. Dependencies are reachable by the same hosts
+as in the cluster. Secrets are read from files named after their keys
+in the secrets directory.`,
+	Args: cobra.NoArgs,
+	RunE: RunRun,
+}
+
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringVar(&runComposeFile, "compose-file", filepath.Join(localStateDir, "run", "compose.yaml"), "Path of the generated compose file")
+	runCmd.Flags().StringVar(&runSecretsDir, "secrets-dir", filepath.Join(localStateDir, "secrets"), "Directory with secret values, one file per key")
+	runCmd.Flags().IntVarP(&runPort, "port", "p", 8080, "Host port the service is published to")
+	runCmd.Flags().BoolVar(&runNoUp, "no-up", false, "Only write the compose file without starting containers")
+}
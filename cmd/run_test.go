@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/chill-cloud/chill-cli/pkg/version/constraint"
+	v1 "k8s.io/api/core/v1"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func runTestDependency(t *testing.T, name string, c string, v version.Version) service.Dependency {
+	parsed, err := constraint.ParseFromString(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &service.RemoteDependency{Name: name, Version: parsed, SpecificVersion: &v}
+}
+
+func TestBuildComposeService(t *testing.T) {
+	KubeNamespace = "staging"
+	defer func() {
+		KubeNamespace = v1.NamespaceDefault
+	}()
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	runDir, secretsDir := t.TempDir(), t.TempDir()
+	writeTestFile(t, filepath.Join(secretsDir, "db-password"), "pa$word\n")
+	cfg := &service.ProjectConfig{
+		Name:           "web",
+		CurrentVersion: &version.Version{Major: 1, Minor: 3},
+		Config:         map[string]string{"GREETING": "costs $5"},
+		Secrets:        []string{"db-password"},
+		Dependencies: map[service.Dependency]bool{
+			// A constraint spanning the major follows the whole major deployment
+			runTestDependency(t, "demo", "v1", version.Version{Major: 1, Minor: 2}):   true,
+			runTestDependency(t, "auth", "v2.1", version.Version{Major: 2, Minor: 1}): true,
+		},
+	}
+
+	name, s, err := buildComposeService(cfg, clusterManager, runDir, secretsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "v3-0-web-v1" || s.Hostname != name || s.Image != "dev.local/web:v1.3.0" {
+		t.Fatalf("wrong service built: %s %+v", name, s)
+	}
+	for k, v := range map[string]string{
+		"CHILL_SELF_NAME":    "web",
+		"CHILL_SELF_VERSION": "v1.3.0",
+		"CHILL_SERVICE_DEMO": "demo-v1.staging.svc.cluster.local",
+		"CHILL_SERVICE_AUTH": "v1-0-auth-v2.staging.svc.cluster.local",
+		"GREETING":           "costs $$5",
+	} {
+		if s.Environment[k] != v {
+			t.Fatalf("%s is set to %q instead of %q", k, s.Environment[k], v)
+		}
+	}
+	// Secret values are not copied to the compose file
+	if _, ok := s.Environment["CHILL_SECRET_DB_PASSWORD"]; ok {
+		t.Fatal("secret value inlined to the compose file")
+	}
+	envFile := filepath.Join(secretsDir, "."+name+".env")
+	if strings.Join(s.EnvFile, ",") != envFile {
+		t.Fatalf("wrong env files: %v", s.EnvFile)
+	}
+	secretEnv, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secretEnv) != "CHILL_SECRET_DB_PASSWORD='pa$word'\n" {
+		t.Fatalf("env file written as %q", secretEnv)
+	}
+	if strings.Join(s.DependsOn, ",") != "v1-0-auth-v2,v2-0-demo-v1" {
+		t.Fatalf("wrong dependencies: %v", s.DependsOn)
+	}
+	configDir := filepath.Join(runDir, "config", name)
+	expectedVolumes := []string{
+		filepath.Join(secretsDir, "db-password") + ":/etc/chill/secret/db-password/" + cluster.ChillSecretKey + ":ro",
+		configDir + ":/etc/chill/config:ro",
+	}
+	if strings.Join(s.Volumes, ",") != strings.Join(expectedVolumes, ",") {
+		t.Fatalf("wrong volumes: %v", s.Volumes)
+	}
+	// Mounted files are not interpolated by compose, so they keep the values as is
+	value, err := os.ReadFile(filepath.Join(configDir, "GREETING"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(value) != "costs $5" {
+		t.Fatalf("config file written as %q", value)
+	}
+	aliases := s.Networks[composeNetwork]["aliases"]
+	if strings.Join(aliases, ",") != "v3-0-web-v1.staging.svc.cluster.local" {
+		t.Fatalf("wrong aliases: %v", aliases)
+	}
+
+	cfg.Secrets = []string{"api-key"}
+	_, _, err = buildComposeService(cfg, clusterManager, runDir, secretsDir)
+	if err == nil || !strings.Contains(err.Error(), "api-key") {
+		t.Fatalf("missing secret reported as %v", err)
+	}
+	writeTestFile(t, filepath.Join(secretsDir, "api-key"), "it's")
+	_, _, err = buildComposeService(cfg, clusterManager, runDir, secretsDir)
+	if err == nil || !strings.Contains(err.Error(), "api-key") {
+		t.Fatalf("quoted secret reported as %v", err)
+	}
+}
+
+func TestAddMajorAliases(t *testing.T) {
+	clusterManager := cluster.NewOffline(KubeNamespace)
+	compose := composeFile{Services: map[string]composeService{}}
+	var configs []*service.ProjectConfig
+	for _, v := range []version.Version{
+		{Major: 1, Minor: 1},
+		{Major: 1, Minor: 2},
+		{Major: 2},
+	} {
+		v := v
+		cfg := &service.ProjectConfig{Name: "demo", CurrentVersion: &v}
+		path := clusterManager.GetRevisionPath(cfg.Name, v)
+		compose.Services[path] = composeService{Networks: map[string]map[string][]string{
+			composeNetwork: {"aliases": {path}},
+		}}
+		configs = append(configs, cfg)
+	}
+	addMajorAliases(&compose, clusterManager, configs)
+
+	for path, expected := range map[string][]string{
+		"v1-0-demo-v1": {"v1-0-demo-v1"},
+		"v2-0-demo-v1": {"v2-0-demo-v1", "demo-v1." + KubeNamespace + ".svc.cluster.local"},
+		"v0-0-demo-v2": {"v0-0-demo-v2", "demo-v2." + KubeNamespace + ".svc.cluster.local"},
+	} {
+		aliases := compose.Services[path].Networks[composeNetwork]["aliases"]
+		if strings.Join(aliases, ",") != strings.Join(expected, ",") {
+			t.Fatalf("%s is aliased as %v", path, aliases)
+		}
+	}
+}
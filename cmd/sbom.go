@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/chill-cloud/chill-cli/pkg/sbom"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/daemon"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+)
+
+var sbomOutput string
+
+// sbomPath is where the SBOM of the version is kept in the project
+func sbomPath(cwd string, v version.Version) string {
+	return filepath.Join(cwd, localStateDir, "sbom", fmt.Sprintf("%s.spdx.json", v.String()))
+}
+
+// pullPlatformImage fetches the image of the current version for the platform from the registry
+func pullPlatformImage(cfg *service.ProjectConfig, platform string) (v1.Image, error) {
+	imageName, _ := cfg.GetBuildTag(ForceLocal)
+	username, password, err := registryCredentials(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var opts []remote.Option
+	if platform != "" {
+		p, err := v1.ParsePlatform(platform)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, remote.WithPlatform(*p))
+	}
+	return image.Pull(imageName, &authn.Basic{Username: username, Password: password}, opts...)
+}
+
+// writeSBOM describes the images of the current version built by the Docker daemon, or pushed
+// to the registry already, along with the locked dependencies; provenance is taken from labels
+// of the images
+func writeSBOM(cwd string, cfg *service.ProjectConfig) error {
+	platforms, err := platformImages(cwd, cfg)
+	if err != nil {
+		return err
+	}
+	imageName, isLocal := cfg.GetBuildTag(ForceLocal)
+	var images []sbom.Image
+	var provenance sbom.Provenance
+	for _, pi := range platforms {
+		ref, err := name.NewTag(pi.tags[0])
+		if err != nil {
+			return err
+		}
+		imgRef := pi.tags[0]
+		img, err := daemon.Image(ref)
+		if err != nil {
+			if isLocal {
+				return fmt.Errorf("unable to read image %s from the Docker daemon: %w\n", pi.tags[0], err)
+			}
+			// The build is skipped if the registry has the image up to date, so the daemon might not have it
+			logging.Logger.Info(fmt.Sprintf("Unable to read image %s from the Docker daemon, pulling it: %s", pi.tags[0], err.Error()))
+			img, err = pullPlatformImage(cfg, pi.platform)
+			if err != nil {
+				return err
+			}
+			imgRef = imageName
+		}
+		imgCfg, err := img.ConfigFile()
+		if err != nil {
+			return err
+		}
+		provenance = sbom.Provenance{
+			Builder:     rootCmd.Name(),
+			Revision:    imgCfg.Config.Labels[ocispec.AnnotationRevision],
+			ContextHash: imgCfg.Config.Labels[image.ContextHashLabel],
+		}
+		images = append(images, sbom.Image{Ref: imgRef, Platform: pi.platform, Image: img})
+	}
+	if len(platforms) > 1 {
+		// Each platform image has its own hash, the one of the version covers them all
+		provenance.ContextHash, err = contextHash(cwd, cfg, buildPlatforms(cfg)...)
+		if err != nil {
+			return err
+		}
+	}
+
+	var deps []sbom.Dependency
+	for dep := range cfg.Dependencies {
+		if dep.GetSpecificVersion() == nil {
+			return fmt.Errorf("specific version must be set for service %s", dep.GetName())
+		}
+		d := sbom.Dependency{Name: dep.GetName(), Version: dep.GetSpecificVersion().String()}
+		if remote, ok := dep.(*service.RemoteDependency); ok {
+			d.Location = remote.Git
+		}
+		deps = append(deps, d)
+	}
+
+	fmt.Println("Generating SBOM...")
+	doc, err := sbom.Generate(cfg.Name, cfg.CurrentVersion.String(), images, deps, provenance)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := sbomPath(cwd, *cfg.CurrentVersion)
+	err = os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(p, data, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("SBOM written to %s\n", p)
+	return nil
+}
+
+func RunSBOM(cmd *cobra.Command, args []string) error {
+	cwd, err := setupProjectDir()
+	if err != nil {
+		return err
+	}
+	v, err := version.ParseFromString(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(sbomPath(cwd, *v))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("no SBOM found for version %s; build it with --sbom", v.String())
+		}
+		return err
+	}
+	if sbomOutput == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(sbomOutput, data, 0644)
+}
+
+// sbomCmd represents the sbom command
+var sbomCmd = &cobra.Command{
+	Use:   "sbom <version>",
+	Short: "Prints the SBOM of a built version",
+	Long: `Prints the SPDX software bill of materials generated by build --sbom.
+It lists files of the image of the version for every platform, the locked
+Chill services the version depends on, and the git revision and build
+context hash the image was built from.`,
+	Args: cobra.ExactArgs(1),
+	RunE: RunSBOM,
+}
+
+func init() {
+	rootCmd.AddCommand(sbomCmd)
+
+	sbomCmd.Flags().StringVarP(&sbomOutput, "output", "o", "", "File to write the SBOM to instead of stdout")
+}
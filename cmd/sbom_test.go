@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/image/imagetest"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"go.uber.org/zap"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSBOMOfImageUpToDateInRegistry(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+	cfg := imagetest.ProjectConfig(host)
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = image.WithLabels(img, map[string]string{image.ContextHashLabel: "sha256:pushed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The build is skipped, so only the registry has the image of the version
+	imageName, _ := cfg.GetBuildTag(false)
+	_, err = image.Push(img, []string{imageName}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, logging.Logger = "test", zap.NewNop()
+	defer func() {
+		token, logging.Logger = "", nil
+	}()
+	cwd := t.TempDir()
+	writeTestFile(t, filepath.Join(cwd, "Dockerfile"), "FROM scratch\n")
+	err = writeSBOM(cwd, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(sbomPath(cwd, *cfg.CurrentVersion))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "sha256:pushed") {
+		t.Fatal("SBOM does not describe the image of the registry")
+	}
+}
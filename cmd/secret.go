@@ -14,7 +14,7 @@ func runGet(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("key does not follow criteria")
 	}
 
-	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeNamespace)
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
 	if err != nil {
 		return fmt.Errorf("unable to build cluster client")
 	}
@@ -34,7 +34,7 @@ func runSet(cmd *cobra.Command, args []string) error {
 	}
 
 	value := args[1]
-	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeNamespace)
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
 	if err != nil {
 		return fmt.Errorf("unable to build cluster client")
 	}
@@ -8,13 +8,12 @@ import (
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cluster"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
 	"github.com/spf13/cobra"
 	"path/filepath"
 )
 
 func RunSetReg(cmd *cobra.Command, args []string) error {
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
@@ -31,7 +30,7 @@ func RunSetReg(cmd *cobra.Command, args []string) error {
 	login := args[1]
 	password := args[2]
 
-	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeNamespace)
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
 	if err != nil {
 		return fmt.Errorf("unable to build cluster client")
 	}
@@ -5,18 +5,19 @@ import (
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cluster"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	url2 "net/url"
 	"os"
 	"strconv"
-	"strings"
 )
 
 func RunStatus(cmd *cobra.Command, args []string) error {
-	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeNamespace)
+	if Backend != backendKnative {
+		return fmt.Errorf("status is only supported by the %s backend; use traffic show instead", backendKnative)
+	}
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
 	if err != nil {
 		return fmt.Errorf("unable to build cluster client")
 	}
@@ -25,7 +26,7 @@ func RunStatus(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("unable to build Knative client")
 	}
 
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
@@ -65,18 +66,13 @@ func RunStatus(cmd *cobra.Command, args []string) error {
 	table.SetHeader([]string{"Version", "Host", "Traffic percent"})
 
 	for _, q := range res.Status.Traffic {
-		url, err := url2.Parse(q.URL.String())
-		if err != nil {
-			return fmt.Errorf("unable to parse URL: %w\n", err)
-		}
-		firstPart := strings.Split(url.Host, ".")[0]
-		_, version, err := clusterManager.GetServiceAndVersion(firstPart)
+		version, err := targetVersion(clusterManager, q)
 		if err != nil {
-			return fmt.Errorf("could not get version from the host")
+			return err
 		}
 		table.Append([]string{
 			version.String(),
-			url.Host,
+			q.URL.Host,
 			strconv.FormatInt(*q.Percent, 10),
 		})
 	}
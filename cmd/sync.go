@@ -5,7 +5,6 @@ import (
 	"fmt"
 	cache2 "github.com/chill-cloud/chill-cli/pkg/cache"
 	"github.com/chill-cloud/chill-cli/pkg/config"
-	"github.com/chill-cloud/chill-cli/pkg/cwd"
 	"github.com/chill-cloud/chill-cli/pkg/integrations/server"
 	"github.com/chill-cloud/chill-cli/pkg/logging"
 	"github.com/chill-cloud/chill-cli/pkg/service"
@@ -190,6 +189,11 @@ func Sync(cwd string, local bool, gen bool) error {
 		}
 	}
 
+	if lockCfg.CurrentVersion == nil || cfg.CurrentVersion.Compare(*lockCfg.CurrentVersion) != 0 {
+		// The digest was recorded for the image of the previous version
+		cfg.ImageDigest = ""
+	}
+
 	// Save lock file
 
 	newLock, err := config.ProcessConfig(cfg)
@@ -227,7 +231,7 @@ func Sync(cwd string, local bool, gen bool) error {
 
 func RunSync(cmd *cobra.Command, args []string) error {
 	// Set up working directory
-	cwd, err := cwd.SetupCwd(Cwd)
+	cwd, err := setupProjectDir()
 	if err != nil {
 		return err
 	}
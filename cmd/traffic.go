@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/config"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	url2 "net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// parseTrafficArgs parses the traffic split of a major service; versions not mentioned receive none
+func parseTrafficArgs(args []string) (map[version.Version]int64, error) {
+	res := map[version.Version]int64{}
+	major := -1
+	var sum int64
+	for _, arg := range args {
+		parts := strings.Split(arg, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("wrong traffic target %s, expected <version>=<percent>", arg)
+		}
+		v, err := version.ParseFromString(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		if !version.IsProduction(*v) {
+			return nil, fmt.Errorf("only production versions might receive traffic")
+		}
+		if major != -1 && major != v.GetMajor() {
+			return nil, fmt.Errorf("traffic might be split only within one major version")
+		}
+		major = v.GetMajor()
+		p, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("wrong percent for version %s: %w", v.String(), err)
+		}
+		if p < 0 || p > 100 {
+			return nil, fmt.Errorf("percent must be between 0 and 100")
+		}
+		if _, ok := res[*v]; ok {
+			return nil, fmt.Errorf("version %s is mentioned twice", v.String())
+		}
+		res[*v] = p
+		sum += p
+	}
+	if sum != 100 {
+		return nil, fmt.Errorf("sum of percents should be 100")
+	}
+	return res, nil
+}
+
+func parseProjectConfig() (*service.ProjectConfig, error) {
+	cwd, err := setupProjectDir()
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := config.ParseConfig(cwd, config.LockConfigName, true)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, fmt.Errorf("no project config found")
+	}
+	return cfg, nil
+}
+
+// targetVersion recovers the version of a tagged traffic target from its host
+func targetVersion(clusterManager cluster.ClusterManager, t servingv1.TrafficTarget) (*version.Version, error) {
+	url, err := url2.Parse(t.URL.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse URL: %w", err)
+	}
+	firstPart := strings.Split(url.Host, ".")[0]
+	_, v, err := clusterManager.GetServiceAndVersion(firstPart)
+	if err != nil {
+		return nil, fmt.Errorf("could not get version from the host")
+	}
+	return v, nil
+}
+
+// revisionVersions maps versions to the tagged revisions of the service
+func revisionVersions(clusterManager cluster.ClusterManager, svc *servingv1.Service) (map[version.Version]servingv1.TrafficTarget, error) {
+	res := map[version.Version]servingv1.TrafficTarget{}
+	for _, t := range svc.Status.Traffic {
+		if t.Tag == "" {
+			continue
+		}
+		v, err := targetVersion(clusterManager, t)
+		if err != nil {
+			return nil, err
+		}
+		res[*v] = t
+	}
+	return res, nil
+}
+
+func RunTrafficShow(cmd *cobra.Command, args []string) error {
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	major := cfg.CurrentVersion.GetMajor()
+	if Major != 0 {
+		major = Major
+	}
+
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return fmt.Errorf("unable to build cluster client")
+	}
+	backend, err := newDeployBackend(clusterManager)
+	if err != nil {
+		return err
+	}
+	traffic, err := backend.Traffic(cfg, major)
+	if err != nil {
+		return err
+	}
+
+	var versions []version.Version
+	for v := range traffic {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Compare(versions[j]) < 0
+	})
+
+	fmt.Printf("Service %s, major version %d\n\n", cfg.Name, major)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Version", "Revision", "Traffic percent"})
+	for _, v := range versions {
+		t := traffic[v]
+		table.Append([]string{
+			v.String(),
+			t.Revision,
+			strconv.FormatInt(t.Percent, 10),
+		})
+	}
+	table.Render()
+	return nil
+}
+
+func RunTrafficSet(cmd *cobra.Command, args []string) error {
+	percents, err := parseTrafficArgs(args)
+	if err != nil {
+		return err
+	}
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	var major int
+	for v := range percents {
+		major = v.GetMajor()
+	}
+
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return fmt.Errorf("unable to build cluster client")
+	}
+	backend, err := newDeployBackend(clusterManager)
+	if err != nil {
+		return err
+	}
+	name := clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: major})
+
+	return withServiceLock(clusterManager, name, func() error {
+		err := backend.SetTraffic(cfg, major, percents)
+		if err != nil {
+			return err
+		}
+		println("Traffic split updated")
+		return nil
+	})
+}
+
+// trafficCmd represents the traffic command
+var trafficCmd = &cobra.Command{
+	Use:   "traffic",
+	Short: "Inspects and edits the traffic split of a major deployment",
+	Run: func(cmd *cobra.Command, args []string) {
+		fmt.Println("Use one of the subcommands")
+	},
+}
+
+var trafficShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Prints traffic percents of every deployed version",
+	RunE:  RunTrafficShow,
+}
+
+var trafficSetCmd = &cobra.Command{
+	Use:   "set <version>=<percent>...",
+	Short: "Splits the traffic between deployed production versions",
+	Long: `Splits the traffic between deployed production versions of one major
+deployment, e.g. "traffic set v1.2.0=90 v1.3.0=10". Percents must sum
+up to 100; versions not mentioned receive no traffic. Only the route
+of the service is changed, no revision is created; the kubernetes
+backend approximates the split by numbers of replicas.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: RunTrafficSet,
+}
+
+func init() {
+	rootCmd.AddCommand(trafficCmd)
+
+	trafficCmd.AddCommand(trafficShowCmd)
+	trafficCmd.AddCommand(trafficSetCmd)
+
+	trafficShowCmd.Flags().IntVarP(&Major, "major", "m", 0, "Overrides major version defined in the lock file")
+	addLockFlags(trafficSetCmd)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"strings"
+	"testing"
+)
+
+func TestParseTrafficArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args     []string
+		expected map[version.Version]int64
+	}{
+		{args: []string{"v1.2.0=90", "v1.3.0=10"}, expected: map[version.Version]int64{
+			{Major: 1, Minor: 2}: 90,
+			{Major: 1, Minor: 3}: 10,
+		}},
+		{args: []string{"1.3=100"}, expected: map[version.Version]int64{{Major: 1, Minor: 3}: 100}},
+		{args: []string{"v1.2.0=90", "v1.3.0=0", "v1.4.0=10"}, expected: map[version.Version]int64{
+			{Major: 1, Minor: 2}: 90,
+			{Major: 1, Minor: 3}: 0,
+			{Major: 1, Minor: 4}: 10,
+		}},
+		// Malformed targets
+		{args: []string{"v1.2.0"}},
+		{args: []string{"v1.2.0=50=50"}},
+		{args: []string{"=100"}},
+		{args: []string{"v1.x.0=100"}},
+		{args: []string{"v1.2.0=all"}},
+		{args: []string{"v1.2.0=-10", "v1.3.0=110"}},
+		// Development versions receive no traffic
+		{args: []string{"v1.2.1=100"}},
+		// Duplicate versions
+		{args: []string{"v1.2.0=50", "v1.2=50"}},
+		// Other majors
+		{args: []string{"v1.2.0=50", "v2.0.0=50"}},
+		// Sums other than 100
+		{args: []string{"v1.2.0=90", "v1.3.0=20"}},
+		{args: []string{"v1.2.0=50"}},
+		{args: nil},
+	} {
+		res, err := parseTrafficArgs(tc.args)
+		name := strings.Join(tc.args, " ")
+		if tc.expected == nil {
+			if err == nil {
+				t.Fatalf("%q accepted", name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q rejected: %v", name, err)
+		}
+		if len(res) != len(tc.expected) {
+			t.Fatalf("%q parsed as %v", name, res)
+		}
+		for v, p := range tc.expected {
+			if res[v] != p {
+				t.Fatalf("%q parsed as %v", name, res)
+			}
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/spf13/cobra"
+	"sort"
+	"strings"
+)
+
+var undeployMajor int
+var undeployForce bool
+
+func RunUndeploy(cmd *cobra.Command, args []string) error {
+	cfg, err := parseProjectConfig()
+	if err != nil {
+		return err
+	}
+	if undeployMajor < 0 {
+		return fmt.Errorf("major version must not be negative")
+	}
+
+	clusterManager, err := cluster.NewForKubernetes(Kubeconfig, KubeContext, KubeNamespace)
+	if err != nil {
+		return fmt.Errorf("unable to build cluster client")
+	}
+	backend, err := newDeployBackend(clusterManager)
+	if err != nil {
+		return err
+	}
+	name := clusterManager.GetServiceIdentifier(cfg.Name, version.Version{Major: undeployMajor})
+
+	return withServiceLock(clusterManager, name, func() error {
+		traffic, err := backend.Traffic(cfg, undeployMajor)
+		if err != nil {
+			return err
+		}
+		var serving []string
+		for _, t := range traffic {
+			if t.Percent > 0 {
+				serving = append(serving, fmt.Sprintf("%s %d%%", t.Revision, t.Percent))
+			}
+		}
+		if len(serving) > 0 && !undeployForce {
+			sort.Strings(serving)
+			return fmt.Errorf("major version %d still receives traffic (%s); use --force to remove it anyway",
+				undeployMajor, strings.Join(serving, ", "))
+		}
+
+		dependents, err := backend.Dependents(cfg.Name)
+		if err != nil {
+			return err
+		}
+		var blocking []string
+		for _, d := range dependents {
+			if d.Major == undeployMajor {
+				blocking = append(blocking, d.String())
+			}
+		}
+		if len(blocking) > 0 {
+			return fmt.Errorf("major version %d is still used by %s", undeployMajor, strings.Join(blocking, ", "))
+		}
+
+		err = backend.Undeploy(cfg, undeployMajor)
+		if err != nil {
+			return err
+		}
+		configMaps, err := listConfigMaps(clusterManager, cfg.Name, undeployMajor)
+		if err != nil {
+			return err
+		}
+		for _, cm := range configMaps {
+			if err := deleteConfigMap(clusterManager, cm); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("Service %s removed\n", name)
+		return nil
+	})
+}
+
+// undeployCmd represents the undeploy command
+var undeployCmd = &cobra.Command{
+	Use:   "undeploy",
+	Short: "Removes a major deployment of the service from the cluster",
+	Long: `Removes the service of the given major version along with all its
+revisions or deployments and plain configuration. Refuses to do so while any
+live revision of another Chill service still depends on the major,
+and, unless forced, while the route still sends traffic to it.`,
+	Args: cobra.NoArgs,
+	RunE: RunUndeploy,
+}
+
+func init() {
+	rootCmd.AddCommand(undeployCmd)
+
+	undeployCmd.Flags().IntVar(&undeployMajor, "major", 0, "Major version to remove")
+	_ = undeployCmd.MarkFlagRequired("major")
+	undeployCmd.Flags().BoolVar(&undeployForce, "force", false, "Remove the major version even if it still receives traffic")
+	addLockFlags(undeployCmd)
+}
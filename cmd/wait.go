@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/logging"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	servingconfig "knative.dev/serving/pkg/apis/config"
+	"knative.dev/serving/pkg/apis/serving"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"sort"
+	"strings"
+	"time"
+)
+
+const waitPollInterval = 2 * time.Second
+const diagnosticsEventsLimit = 10
+const diagnosticsLogLines = 50
+
+// userContainerName is the container of the service in pods of Knative revisions
+const userContainerName = servingconfig.DefaultUserContainerName
+
+// waitForService waits until the service observes its latest generation and becomes ready;
+// if it fails or the timeout is exceeded, diagnostics of the latest revision are printed
+func waitForService(clusterManager cluster.ClusterManager, name string, timeout time.Duration) error {
+	knative, err := clusterManager.GetKnative()
+	if err != nil {
+		return fmt.Errorf("unable to build Knative client")
+	}
+
+	fmt.Printf("Waiting for service %s to become ready...\n", name)
+
+	var svc *servingv1.Service
+	err = wait.PollImmediate(waitPollInterval, timeout, func() (bool, error) {
+		svc, err = knative.Services(KubeNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		if svc.IsFailed() {
+			return true, nil
+		}
+		return svc.IsReady(), nil
+	})
+	if err != nil && !errors.Is(err, wait.ErrWaitTimeout) {
+		return err
+	}
+	if svc.IsReady() {
+		fmt.Printf("Service %s is ready, latest revision: %s\n", name, svc.Status.LatestReadyRevisionName)
+		return nil
+	}
+
+	describeServiceFailure(clusterManager, svc)
+	if err != nil {
+		return fmt.Errorf("service %s did not become ready in %s", name, timeout.String())
+	}
+	return fmt.Errorf("service %s is not ready: %s", name, svc.Status.GetCondition(apis.ConditionReady).GetReason())
+}
+
+func printConditions(kind string, name string, conditions duckv1.Conditions) {
+	for _, c := range conditions {
+		if c.IsTrue() {
+			continue
+		}
+		fmt.Printf("%s %s: condition %s is %s, reason: %s\n", kind, name, c.Type, c.Status, c.Reason)
+		if c.Message != "" {
+			fmt.Printf("  %s\n", c.Message)
+		}
+	}
+}
+
+// describeServiceFailure prints everything that might explain why the latest revision is not ready;
+// diagnostics are best effort, so errors are only logged
+func describeServiceFailure(clusterManager cluster.ClusterManager, svc *servingv1.Service) {
+	printConditions("Service", svc.Name, svc.Status.Conditions)
+
+	revisionName := svc.Status.LatestCreatedRevisionName
+	if revisionName == "" {
+		return
+	}
+
+	knative, err := clusterManager.GetKnative()
+	if err != nil {
+		logging.Logger.Warn(fmt.Sprintf("Unable to build Knative client: %s", err.Error()))
+		return
+	}
+	revision, err := knative.Revisions(KubeNamespace).Get(context.TODO(), revisionName, metav1.GetOptions{})
+	if err != nil {
+		logging.Logger.Warn(fmt.Sprintf("Unable to fetch revision %s: %s", revisionName, err.Error()))
+	} else {
+		printConditions("Revision", revision.Name, revision.Status.Conditions)
+	}
+
+	k8sClient, err := clusterManager.GetKubernetesClient()
+	if err != nil {
+		logging.Logger.Warn(fmt.Sprintf("Unable to build Kubernetes client: %s", err.Error()))
+		return
+	}
+	pods, err := k8sClient.CoreV1().Pods(KubeNamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=%s", serving.RevisionLabelKey, revisionName),
+	})
+	if err != nil {
+		logging.Logger.Warn(fmt.Sprintf("Unable to list pods: %s", err.Error()))
+		return
+	}
+	for _, pod := range pods.Items {
+		fmt.Printf("\nPod %s (%s)\n", pod.Name, pod.Status.Phase)
+		for _, s := range pod.Status.ContainerStatuses {
+			if s.State.Waiting != nil {
+				fmt.Printf("  container %s waiting: %s %s\n", s.Name, s.State.Waiting.Reason, s.State.Waiting.Message)
+			}
+			if s.LastTerminationState.Terminated != nil {
+				t := s.LastTerminationState.Terminated
+				fmt.Printf("  container %s terminated with code %d: %s\n", s.Name, t.ExitCode, t.Reason)
+			}
+		}
+
+		events, err := k8sClient.CoreV1().Events(KubeNamespace).List(context.TODO(), metav1.ListOptions{
+			FieldSelector: fmt.Sprintf("involvedObject.name=%s", pod.Name),
+		})
+		if err != nil {
+			logging.Logger.Warn(fmt.Sprintf("Unable to list events: %s", err.Error()))
+		} else {
+			items := events.Items
+			sort.Slice(items, func(i, j int) bool {
+				return items[i].LastTimestamp.Before(&items[j].LastTimestamp)
+			})
+			if len(items) > diagnosticsEventsLimit {
+				items = items[len(items)-diagnosticsEventsLimit:]
+			}
+			fmt.Println("Recent events:")
+			for _, e := range items {
+				fmt.Printf("  %s %s: %s\n", e.Type, e.Reason, e.Message)
+			}
+		}
+
+		tailLines := int64(diagnosticsLogLines)
+		logs, err := k8sClient.CoreV1().Pods(KubeNamespace).GetLogs(pod.Name, &v1.PodLogOptions{
+			Container: userContainerName,
+			TailLines: &tailLines,
+		}).DoRaw(context.TODO())
+		if err != nil {
+			logging.Logger.Warn(fmt.Sprintf("Unable to fetch logs: %s", err.Error()))
+		} else {
+			fmt.Printf("Container logs:\n%s\n", strings.TrimRight(string(logs), "\n"))
+		}
+	}
+}
@@ -31,6 +31,8 @@ type SourceOfTruth interface {
 	FreezeVersion(v version.Version) error
 	IsFrozen() (bool, error)
 	IsClean() ([]string, error)
+	GetRevision() (string, error)
+	GetCommittedFile(name string) ([]byte, error)
 }
 
 type localSourceOfTruth struct {
@@ -163,6 +165,36 @@ func (s *localSourceOfTruth) IsClean() ([]string, error) {
 	return nil, nil
 }
 
+// GetRevision returns the hash of the HEAD commit
+func (s *localSourceOfTruth) GetRevision() (string, error) {
+	head, err := s.Repository.Head()
+	if err != nil {
+		return "", fmt.Errorf("unable to resolve HEAD: %w", err)
+	}
+	return head.Hash().String(), nil
+}
+
+// GetCommittedFile returns contents of the file at the HEAD commit
+func (s *localSourceOfTruth) GetCommittedFile(name string) ([]byte, error) {
+	head, err := s.Repository.Head()
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve HEAD: %w", err)
+	}
+	commit, err := s.Repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	f, err := commit.File(name)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := f.Contents()
+	if err != nil {
+		return nil, err
+	}
+	return []byte(contents), nil
+}
+
 func (s *localSourceOfTruth) FreezeVersion(v version.Version) error {
 	clean, err := s.IsClean()
 
@@ -29,6 +29,8 @@ const (
 	ChillSecretKey = "chill-secret"
 )
 
+var errOffline = errors2.New("cluster is not configured")
+
 type kubernetesClusterManager struct {
 	Config    *rest.Config
 	Namespace string
@@ -92,6 +94,9 @@ func (k *kubernetesClusterManager) GetInternalServiceHost(serviceName string, v
 }
 
 func (k *kubernetesClusterManager) GetKnative() (v1.ServingV1Interface, error) {
+	if k.Config == nil {
+		return nil, errOffline
+	}
 	deploymentsClient, err := knative.NewForConfig(k.Config)
 	if err != nil {
 		return nil, err
@@ -100,6 +105,9 @@ func (k *kubernetesClusterManager) GetKnative() (v1.ServingV1Interface, error) {
 }
 
 func (k *kubernetesClusterManager) setSecret(key string, value string, mapKey string, secretType v13.SecretType) error {
+	if k.Config == nil {
+		return errOffline
+	}
 	kubeClient, err := kubernetes.NewForConfig(k.Config)
 	if err != nil {
 		return err
@@ -188,6 +196,9 @@ func (k *kubernetesClusterManager) GetRegistry(serviceName string, server string
 }
 
 func (k *kubernetesClusterManager) getSecret(key string, mapKey string) (string, error) {
+	if k.Config == nil {
+		return "", errOffline
+	}
 	kubeClient, err := kubernetes.NewForConfig(k.Config)
 	if err != nil {
 		return "", err
@@ -216,6 +227,9 @@ func GetKubeconfigPath(forceConfig string) (string, error) {
 }
 
 func (k *kubernetesClusterManager) GetLockerClient() (dynamic.Interface, error) {
+	if k.Config == nil {
+		return nil, errOffline
+	}
 	kubeClient, err := dynamic.NewForConfig(k.Config)
 	if err != nil {
 		return nil, err
@@ -224,6 +238,9 @@ func (k *kubernetesClusterManager) GetLockerClient() (dynamic.Interface, error)
 }
 
 func (k *kubernetesClusterManager) GetKubernetesClient() (*kubernetes.Clientset, error) {
+	if k.Config == nil {
+		return nil, errOffline
+	}
 	kubeClient, err := kubernetes.NewForConfig(k.Config)
 	if err != nil {
 		return nil, err
@@ -231,12 +248,16 @@ func (k *kubernetesClusterManager) GetKubernetesClient() (*kubernetes.Clientset,
 	return kubeClient, nil
 }
 
-func NewForKubernetes(forceConfig string, namespace string) (ClusterManager, error) {
+// NewForKubernetes connects to the cluster of the kubeconfig context, the current one if empty
+func NewForKubernetes(forceConfig string, kubeContext string, namespace string) (ClusterManager, error) {
 	forceConfig, err := GetKubeconfigPath(forceConfig)
 	if err != nil {
 		return nil, err
 	}
-	config, err := clientcmd.BuildConfigFromFlags("", forceConfig)
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: forceConfig},
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+	).ClientConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -245,3 +266,10 @@ func NewForKubernetes(forceConfig string, namespace string) (ClusterManager, err
 		Namespace: namespace,
 	}, nil
 }
+
+// NewOffline returns a manager which is only able to resolve names, all the cluster queries fail
+func NewOffline(namespace string) ClusterManager {
+	return &kubernetesClusterManager{
+		Namespace: namespace,
+	}
+}
@@ -0,0 +1,157 @@
+package cluster
+
+import (
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/util"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"sort"
+)
+
+// RevisionTag returns a Knative traffic tag of the revision within its major service
+func RevisionTag(v version.Version) string {
+	return fmt.Sprintf("v%d-%d", v.GetMinor(), v.GetPatch())
+}
+
+// ParseRevisionTag is the inverse of RevisionTag; major version is not stored in the tag, so it must be provided
+func ParseRevisionTag(tag string, major int) (*version.Version, error) {
+	var minor, patch int
+	_, err := fmt.Sscanf(tag, "v%d-%d", &minor, &patch)
+	if err != nil {
+		return nil, fmt.Errorf("wrong revision tag format %s: %w", tag, err)
+	}
+	if minor < 0 || patch < 0 {
+		return nil, fmt.Errorf("wrong revision tag format %s", tag)
+	}
+	return &version.Version{Major: major, Minor: minor, Patch: patch}, nil
+}
+
+// RetargetTraffic builds a new route from the current traffic status, keeping every tagged
+// revision reachable and assigning percents to them; untouched revisions receive zero traffic
+func RetargetTraffic(
+	status []servingv1.TrafficTarget,
+	major int,
+	percents map[version.Version]int64,
+) ([]servingv1.TrafficTarget, error) {
+	var res []servingv1.TrafficTarget
+	found := map[version.Version]bool{}
+	for _, t := range status {
+		if t.Tag == "" {
+			continue
+		}
+		v, err := ParseRevisionTag(t.Tag, major)
+		if err != nil {
+			return nil, err
+		}
+		if found[*v] {
+			continue
+		}
+		found[*v] = true
+		res = append(res, servingv1.TrafficTarget{
+			RevisionName:      t.RevisionName,
+			ConfigurationName: t.ConfigurationName,
+			LatestRevision:    util.BoolPtr(false),
+			Percent:           util.Int64Ptr(percents[*v]),
+			Tag:               t.Tag,
+		})
+	}
+	var sum int64
+	for v, p := range percents {
+		if !found[v] {
+			return nil, fmt.Errorf("no revision found for version %s", v.String())
+		}
+		sum += p
+	}
+	if sum != 100 {
+		return nil, fmt.Errorf("sum of percents should be 100")
+	}
+	return res, nil
+}
+
+// ScaleTraffic gives the target version the percent of traffic, the rest is split
+// between the other versions proportionally to the previous split
+func ScaleTraffic(previous map[version.Version]int64, target version.Version, percent int64) (map[version.Version]int64, error) {
+	if percent < 0 || percent > 100 {
+		return nil, fmt.Errorf("percent must be between 0 and 100")
+	}
+	var others []version.Version
+	var total int64
+	for v, p := range previous {
+		if v != target && p > 0 {
+			others = append(others, v)
+			total += p
+		}
+	}
+	rest := 100 - percent
+	if total == 0 && rest > 0 {
+		return nil, fmt.Errorf("no other version receives traffic")
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Compare(others[j]) > 0
+	})
+
+	res := map[version.Version]int64{target: percent}
+	remainders := map[version.Version]int64{}
+	var assigned int64
+	for _, v := range others {
+		res[v] = previous[v] * rest / total
+		remainders[v] = previous[v] * rest % total
+		assigned += res[v]
+	}
+	// Largest remainder method keeps the sum exactly 100
+	sort.SliceStable(others, func(i, j int) bool {
+		return remainders[others[i]] > remainders[others[j]]
+	})
+	for i := 0; assigned < rest; i++ {
+		res[others[i]]++
+		assigned++
+	}
+	return res, nil
+}
+
+// ReplicaCounts approximates the traffic split by numbers of replicas of versions serving the same host;
+// the total is at least minReplicas and big enough to give every receiving version a replica,
+// unless it exceeds maxReplicas (zero stands for unlimited); versions receiving no traffic get no serving replicas
+func ReplicaCounts(percents map[version.Version]int64, minReplicas int32, maxReplicas int32) map[version.Version]int32 {
+	total := minReplicas
+	if total < 1 {
+		total = 1
+	}
+	var receiving []version.Version
+	for v, p := range percents {
+		if p <= 0 {
+			continue
+		}
+		receiving = append(receiving, v)
+		need := int32((100 + p - 1) / p)
+		if need > total {
+			total = need
+		}
+	}
+	if maxReplicas > 0 && total > maxReplicas {
+		total = maxReplicas
+	}
+	sort.Slice(receiving, func(i, j int) bool {
+		return receiving[i].Compare(receiving[j]) > 0
+	})
+
+	res := map[version.Version]int32{}
+	for v := range percents {
+		res[v] = 0
+	}
+	remainders := map[version.Version]int64{}
+	var assigned int32
+	for _, v := range receiving {
+		res[v] = int32(percents[v] * int64(total) / 100)
+		remainders[v] = percents[v] * int64(total) % 100
+		assigned += res[v]
+	}
+	sort.SliceStable(receiving, func(i, j int) bool {
+		return remainders[receiving[i]] > remainders[receiving[j]]
+	})
+	for i := 0; assigned < total && i < len(receiving); i++ {
+		res[receiving[i]]++
+		assigned++
+	}
+	return res
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	service2 "github.com/chill-cloud/chill-cli/pkg/service"
+	"path/filepath"
+	"strings"
+)
+
+type SerializedBuild struct {
+	Dockerfile string            `yaml:"dockerfile,omitempty"`
+	Context    string            `yaml:"context,omitempty"`
+	Args       map[string]string `yaml:"args,omitempty"`
+	Target     string            `yaml:"target,omitempty"`
+	Tags       []string          `yaml:"tags,omitempty"`
+	Platforms  []string          `yaml:"platforms,omitempty"`
+}
+
+// checkProjectPath makes sure the path does not point outside of the project
+func checkProjectPath(p string, what string) error {
+	if p == "" {
+		return nil
+	}
+	if filepath.IsAbs(p) {
+		return fmt.Errorf("%s must be relative to the project root", what)
+	}
+	clean := filepath.Clean(p)
+	if clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s must be inside the project", what)
+	}
+	return nil
+}
+
+// checkBuildTemplate renders the template with sample data to catch references to unknown fields
+func checkBuildTemplate(s string, what string) error {
+	_, err := service2.RenderBuildTemplate(s, service2.BuildTemplateData{Name: "service", Version: "1.0.0"})
+	if err != nil {
+		return fmt.Errorf("wrong template of %s: %w", what, err)
+	}
+	return nil
+}
+
+// ValidatePlatforms checks that platforms are set as os/arch[/variant] with no duplicates
+func ValidatePlatforms(platforms []string) error {
+	seen := map[string]bool{}
+	for _, p := range platforms {
+		parts := strings.Split(p, "/")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("wrong platform %s, os/arch[/variant] expected", p)
+		}
+		for _, part := range parts {
+			if part == "" {
+				return fmt.Errorf("wrong platform %s, os/arch[/variant] expected", p)
+			}
+		}
+		if seen[p] {
+			return fmt.Errorf("platform %s is set twice", p)
+		}
+		seen[p] = true
+	}
+	return nil
+}
+
+func parseBuild(s *SerializedBuild) (*service2.BuildConfig, error) {
+	if s == nil {
+		return nil, nil
+	}
+	if err := checkProjectPath(s.Dockerfile, "dockerfile"); err != nil {
+		return nil, err
+	}
+	if err := checkProjectPath(s.Context, "context"); err != nil {
+		return nil, err
+	}
+	for k, v := range s.Args {
+		if k == "" {
+			return nil, fmt.Errorf("build arg name must not be empty")
+		}
+		if err := checkBuildTemplate(v, "build arg "+k); err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range s.Tags {
+		if t == "" {
+			return nil, fmt.Errorf("extra tag must not be empty")
+		}
+		if err := checkBuildTemplate(t, "tag "+t); err != nil {
+			return nil, err
+		}
+	}
+	if err := ValidatePlatforms(s.Platforms); err != nil {
+		return nil, err
+	}
+	return &service2.BuildConfig{
+		Dockerfile: s.Dockerfile,
+		Context:    s.Context,
+		Args:       s.Args,
+		Target:     s.Target,
+		Tags:       s.Tags,
+		Platforms:  s.Platforms,
+	}, nil
+}
+
+func processBuild(b *service2.BuildConfig) *SerializedBuild {
+	if b == nil {
+		return nil
+	}
+	return &SerializedBuild{
+		Dockerfile: b.Dockerfile,
+		Context:    b.Context,
+		Args:       b.Args,
+		Target:     b.Target,
+		Tags:       b.Tags,
+		Platforms:  b.Platforms,
+	}
+}
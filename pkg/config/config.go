@@ -8,6 +8,7 @@ import (
 	service2 "github.com/chill-cloud/chill-cli/pkg/service"
 	"github.com/chill-cloud/chill-cli/pkg/version"
 	"github.com/chill-cloud/chill-cli/pkg/version/constraint"
+	"github.com/opencontainers/go-digest"
 	"gopkg.in/yaml.v3"
 	"io/ioutil"
 	"os"
@@ -37,17 +38,25 @@ type SerializedDependency struct {
 }
 
 type SerializedService struct {
-	Name           string                          `yaml:"name,omitempty"`
-	Registry       string                          `yaml:"registry,omitempty"`
-	Remote         string                          `yaml:"remote,omitempty"`
-	Clients        map[string]string               `yaml:"clients,omitempty"`
-	BaseVersion    string                          `yaml:"baseVersion,omitempty"`
-	CurrentVersion string                          `yaml:"currentVersion,omitempty"`
-	Stage          string                          `yaml:"stage"`
-	Integration    string                          `yaml:"integration"`
-	Dependencies   map[string]SerializedDependency `yaml:"dependencies"`
-	TrafficTargets map[string]int                  `yaml:"trafficTargets,omitempty"`
-	Secrets        []string                        `yaml:"secrets,omitempty"`
+	Name           string                           `yaml:"name,omitempty"`
+	Registry       string                           `yaml:"registry,omitempty"`
+	Remote         string                           `yaml:"remote,omitempty"`
+	Clients        map[string]string                `yaml:"clients,omitempty"`
+	BaseVersion    string                           `yaml:"baseVersion,omitempty"`
+	CurrentVersion string                           `yaml:"currentVersion,omitempty"`
+	Stage          string                           `yaml:"stage"`
+	Integration    string                           `yaml:"integration"`
+	Dependencies   map[string]SerializedDependency  `yaml:"dependencies"`
+	TrafficTargets map[string]int                   `yaml:"trafficTargets,omitempty"`
+	Secrets        []string                         `yaml:"secrets,omitempty"`
+	Runtime        *SerializedRuntime               `yaml:"runtime,omitempty"`
+	Probes         *SerializedProbes                `yaml:"probes,omitempty"`
+	Build          *SerializedBuild                 `yaml:"build,omitempty"`
+	Local          *SerializedLocal                 `yaml:"local,omitempty"`
+	Signing        *SerializedSigning               `yaml:"signing,omitempty"`
+	ImageDigest    string                           `yaml:"imageDigest,omitempty"`
+	Config         map[string]string                `yaml:"config,omitempty"`
+	Environments   map[string]SerializedEnvironment `yaml:"environments,omitempty"`
 }
 
 const lockWarning = `# THIS IS AN AUTO-GENERATED FILE; DO NOT MODIFY!
@@ -95,6 +104,38 @@ func parseDependencies(m map[string]SerializedDependency) (map[service2.Dependen
 	return res, nil
 }
 
+func parseTrafficTargets(m map[string]int) (map[version.Version]int, error) {
+	if m == nil {
+		return nil, nil
+	}
+	res := map[version.Version]int{}
+	sum := 0
+	for vs, p := range m {
+		v, err := version.ParseFromString(vs)
+		if err != nil {
+			return nil, err
+		}
+		res[*v] = p
+		sum += p
+	}
+
+	if sum != 100 {
+		return nil, fmt.Errorf("sum of percents should be 100")
+	}
+	return res, nil
+}
+
+func processTrafficTargets(m map[version.Version]int) map[string]int {
+	if m == nil {
+		return nil
+	}
+	res := map[string]int{}
+	for ver, percent := range m {
+		res[ver.String()] = percent
+	}
+	return res
+}
+
 func ParseConfig(cwd string, file string, lock bool) (*service2.ProjectConfig, error) {
 	configFile := filepath.Join(cwd, file)
 	data, err := ioutil.ReadFile(configFile)
@@ -105,8 +146,13 @@ func ParseConfig(cwd string, file string, lock bool) (*service2.ProjectConfig, e
 			return nil, err
 		}
 	}
+	return ParseConfigData(data, lock)
+}
+
+// ParseConfigData parses contents of a config or a lock file
+func ParseConfigData(data []byte, lock bool) (*service2.ProjectConfig, error) {
 	var l SerializedLockFile
-	err = yaml.Unmarshal(data, &l)
+	err := yaml.Unmarshal(data, &l)
 	s := &l.Service
 	if err != nil {
 		return nil, err
@@ -155,24 +201,58 @@ func ParseConfig(cwd string, file string, lock bool) (*service2.ProjectConfig, e
 		return nil, err
 	}
 
-	if s.TrafficTargets != nil {
-		c.TrafficTargets = map[version.Version]int{}
-		sum := 0
-		for vs, p := range s.TrafficTargets {
-			v, err := version.ParseFromString(vs)
-			if err != nil {
-				return nil, err
-			}
-			c.TrafficTargets[*v] = p
-			sum += p
-		}
+	c.TrafficTargets, err = parseTrafficTargets(s.TrafficTargets)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Secrets = s.Secrets
+
+	c.Runtime, err = parseRuntime(s.Runtime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid runtime settings: %w", err)
+	}
 
-		if sum != 100 {
-			return nil, fmt.Errorf("sum of percents should be 100")
+	c.Probes, err = parseProbes(s.Probes)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Build, err = parseBuild(s.Build)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build settings: %w", err)
+	}
+
+	c.Local, err = parseLocal(s.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid local cluster settings: %w", err)
+	}
+
+	c.Signing, err = parseSigning(s.Signing)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing settings: %w", err)
+	}
+
+	if s.ImageDigest != "" {
+		if !lock {
+			return nil, fmt.Errorf("image digest should not be set in a config file")
 		}
+		d, err := digest.Parse(s.ImageDigest)
+		if err != nil {
+			return nil, fmt.Errorf("wrong image digest %s: %w", s.ImageDigest, err)
+		}
+		c.ImageDigest = d.String()
 	}
 
-	c.Secrets = s.Secrets
+	if err := validateConfigKeys(&c, s.Config); err != nil {
+		return nil, err
+	}
+	c.Config = s.Config
+
+	c.Environments, err = parseEnvironments(&c, s.Environments)
+	if err != nil {
+		return nil, err
+	}
 
 	return &c, nil
 }
@@ -209,13 +289,20 @@ func ProcessConfig(c *service2.ProjectConfig) (*SerializedService, error) {
 			return nil, fmt.Errorf("unknown type of dependency")
 		}
 	}
-	if c.TrafficTargets != nil {
-		s.TrafficTargets = map[string]int{}
-		for ver, percent := range c.TrafficTargets {
-			s.TrafficTargets[ver.String()] = percent
-		}
-	}
+	s.TrafficTargets = processTrafficTargets(c.TrafficTargets)
 	s.Secrets = c.Secrets
+	s.Runtime = processRuntime(c.Runtime)
+	s.Probes = processProbes(c.Probes)
+	s.Build = processBuild(c.Build)
+	s.Local = processLocal(c.Local)
+	signing, err := processSigning(c.Signing)
+	if err != nil {
+		return nil, err
+	}
+	s.Signing = signing
+	s.ImageDigest = c.ImageDigest
+	s.Config = c.Config
+	s.Environments = processEnvironments(c.Environments)
 	return &s, nil
 }
 
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+	service2 "github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/service/naming"
+)
+
+type SerializedEnvironment struct {
+	KubeContext    string            `yaml:"kubeContext,omitempty"`
+	Namespace      string            `yaml:"namespace,omitempty"`
+	Registry       string            `yaml:"registry,omitempty"`
+	Backend        string            `yaml:"backend,omitempty"`
+	TrafficTargets map[string]int    `yaml:"trafficTargets,omitempty"`
+	Config         map[string]string `yaml:"config,omitempty"`
+}
+
+func parseEnvironments(c *service2.ProjectConfig, m map[string]SerializedEnvironment) (map[string]service2.Environment, error) {
+	if m == nil {
+		return nil, nil
+	}
+	res := map[string]service2.Environment{}
+	for name, data := range m {
+		if !naming.Validate(name) {
+			return nil, fmt.Errorf("environment name %s does not follow criteria", name)
+		}
+		if err := validateConfigKeys(c, data.Config); err != nil {
+			return nil, fmt.Errorf("environment %s: %w", name, err)
+		}
+		if data.Backend != "" && data.Backend != "knative" && data.Backend != "kubernetes" {
+			return nil, fmt.Errorf("environment %s: unknown backend %s", name, data.Backend)
+		}
+		trafficTargets, err := parseTrafficTargets(data.TrafficTargets)
+		if err != nil {
+			return nil, fmt.Errorf("environment %s: %w", name, err)
+		}
+		res[name] = service2.Environment{
+			KubeContext:    data.KubeContext,
+			Namespace:      data.Namespace,
+			Registry:       data.Registry,
+			Backend:        data.Backend,
+			TrafficTargets: trafficTargets,
+			Config:         data.Config,
+		}
+	}
+	return res, nil
+}
+
+func processEnvironments(m map[string]service2.Environment) map[string]SerializedEnvironment {
+	if m == nil {
+		return nil
+	}
+	res := map[string]SerializedEnvironment{}
+	for name, e := range m {
+		res[name] = SerializedEnvironment{
+			KubeContext:    e.KubeContext,
+			Namespace:      e.Namespace,
+			Registry:       e.Registry,
+			Backend:        e.Backend,
+			TrafficTargets: processTrafficTargets(e.TrafficTargets),
+			Config:         e.Config,
+		}
+	}
+	return res
+}
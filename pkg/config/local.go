@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	service2 "github.com/chill-cloud/chill-cli/pkg/service"
+)
+
+type SerializedLocal struct {
+	Loader          string `yaml:"loader,omitempty"`
+	Registry        string `yaml:"registry,omitempty"`
+	MinikubeProfile string `yaml:"minikubeProfile,omitempty"`
+	KindCluster     string `yaml:"kindCluster,omitempty"`
+}
+
+func parseLocal(s *SerializedLocal) (*service2.LocalConfig, error) {
+	if s == nil {
+		return nil, nil
+	}
+	switch s.Loader {
+	case "", "minikube", "kind", "registry":
+	default:
+		return nil, fmt.Errorf("unknown loader %s", s.Loader)
+	}
+	if s.Registry != "" && s.Loader != "registry" {
+		return nil, fmt.Errorf("registry is only used by the registry loader")
+	}
+	return &service2.LocalConfig{
+		Loader:          s.Loader,
+		Registry:        s.Registry,
+		MinikubeProfile: s.MinikubeProfile,
+		KindCluster:     s.KindCluster,
+	}, nil
+}
+
+func processLocal(l *service2.LocalConfig) *SerializedLocal {
+	if l == nil {
+		return nil
+	}
+	return &SerializedLocal{
+		Loader:          l.Loader,
+		Registry:        l.Registry,
+		MinikubeProfile: l.MinikubeProfile,
+		KindCluster:     l.KindCluster,
+	}
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"fmt"
+	service2 "github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/service/naming"
+)
+
+// validateConfigKeys makes sure plain configuration never shadows variables set by Chill
+func validateConfigKeys(c *service2.ProjectConfig, values map[string]string) error {
+	reserved := map[string]string{}
+	for dep := range c.Dependencies {
+		reserved[naming.NameToEnv(dep.GetName())] = fmt.Sprintf("dependency %s", dep.GetName())
+	}
+	for _, s := range c.Secrets {
+		reserved[naming.SecretToEnv(s)] = fmt.Sprintf("secret %s", s)
+	}
+	for key := range values {
+		if !naming.ValidateEnv(key) {
+			return fmt.Errorf("config key %s is not a valid environment variable name", key)
+		}
+		if what, ok := reserved[key]; ok {
+			return fmt.Errorf("config key %s collides with %s", key, what)
+		}
+		if naming.IsReservedEnv(key) {
+			return fmt.Errorf("config key %s is reserved by Chill", key)
+		}
+	}
+	return nil
+}
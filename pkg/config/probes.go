@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	service2 "github.com/chill-cloud/chill-cli/pkg/service"
+	"strings"
+)
+
+type SerializedProbe struct {
+	Type                string   `yaml:"type"`
+	Path                string   `yaml:"path,omitempty"`
+	Command             []string `yaml:"command,omitempty"`
+	Service             string   `yaml:"service,omitempty"`
+	InitialDelaySeconds *int     `yaml:"initialDelaySeconds,omitempty"`
+	PeriodSeconds       *int     `yaml:"periodSeconds,omitempty"`
+	TimeoutSeconds      *int     `yaml:"timeoutSeconds,omitempty"`
+	FailureThreshold    *int     `yaml:"failureThreshold,omitempty"`
+}
+
+type SerializedProbes struct {
+	Liveness  *SerializedProbe `yaml:"liveness,omitempty"`
+	Readiness *SerializedProbe `yaml:"readiness,omitempty"`
+}
+
+var probeTypes = map[string]service2.ProbeType{
+	string(service2.ProbeGRPC): service2.ProbeGRPC,
+	string(service2.ProbeHTTP): service2.ProbeHTTP,
+	string(service2.ProbeTCP):  service2.ProbeTCP,
+	string(service2.ProbeExec): service2.ProbeExec,
+	string(service2.ProbeNone): service2.ProbeNone,
+}
+
+func checkPositive(v *int, what string) error {
+	if v != nil && *v <= 0 {
+		return fmt.Errorf("%s must be positive", what)
+	}
+	return nil
+}
+
+func parseProbe(s *SerializedProbe, what string) (*service2.Probe, error) {
+	if s == nil {
+		return nil, nil
+	}
+	t, ok := probeTypes[s.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown %s probe type %s", what, s.Type)
+	}
+	switch t {
+	case service2.ProbeHTTP:
+		if !strings.HasPrefix(s.Path, "/") {
+			return nil, fmt.Errorf("%s probe path must be absolute", what)
+		}
+	case service2.ProbeExec:
+		if len(s.Command) == 0 {
+			return nil, fmt.Errorf("%s probe command must be set", what)
+		}
+	}
+	if err := checkNotNegative(s.InitialDelaySeconds, what+" probe initialDelaySeconds"); err != nil {
+		return nil, err
+	}
+	if err := checkPositive(s.PeriodSeconds, what+" probe periodSeconds"); err != nil {
+		return nil, err
+	}
+	if err := checkPositive(s.TimeoutSeconds, what+" probe timeoutSeconds"); err != nil {
+		return nil, err
+	}
+	if err := checkPositive(s.FailureThreshold, what+" probe failureThreshold"); err != nil {
+		return nil, err
+	}
+	return &service2.Probe{
+		Type:                t,
+		Path:                s.Path,
+		Command:             s.Command,
+		GRPCService:         s.Service,
+		InitialDelaySeconds: s.InitialDelaySeconds,
+		PeriodSeconds:       s.PeriodSeconds,
+		TimeoutSeconds:      s.TimeoutSeconds,
+		FailureThreshold:    s.FailureThreshold,
+	}, nil
+}
+
+func parseProbes(s *SerializedProbes) (*service2.ProbesConfig, error) {
+	if s == nil {
+		return nil, nil
+	}
+	liveness, err := parseProbe(s.Liveness, "liveness")
+	if err != nil {
+		return nil, err
+	}
+	readiness, err := parseProbe(s.Readiness, "readiness")
+	if err != nil {
+		return nil, err
+	}
+	return &service2.ProbesConfig{
+		Liveness:  liveness,
+		Readiness: readiness,
+	}, nil
+}
+
+func processProbe(p *service2.Probe) *SerializedProbe {
+	if p == nil {
+		return nil
+	}
+	return &SerializedProbe{
+		Type:                string(p.Type),
+		Path:                p.Path,
+		Command:             p.Command,
+		Service:             p.GRPCService,
+		InitialDelaySeconds: p.InitialDelaySeconds,
+		PeriodSeconds:       p.PeriodSeconds,
+		TimeoutSeconds:      p.TimeoutSeconds,
+		FailureThreshold:    p.FailureThreshold,
+	}
+}
+
+func processProbes(p *service2.ProbesConfig) *SerializedProbes {
+	if p == nil {
+		return nil
+	}
+	return &SerializedProbes{
+		Liveness:  processProbe(p.Liveness),
+		Readiness: processProbe(p.Readiness),
+	}
+}
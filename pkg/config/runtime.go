@@ -0,0 +1,154 @@
+package config
+
+import (
+	"fmt"
+	service2 "github.com/chill-cloud/chill-cli/pkg/service"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+type SerializedResources struct {
+	CPU    string `yaml:"cpu,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+}
+
+type SerializedRuntime struct {
+	Requests             *SerializedResources `yaml:"requests,omitempty"`
+	Limits               *SerializedResources `yaml:"limits,omitempty"`
+	MinScale             *int                 `yaml:"minScale,omitempty"`
+	MaxScale             *int                 `yaml:"maxScale,omitempty"`
+	ContainerConcurrency *int                 `yaml:"containerConcurrency,omitempty"`
+	TargetConcurrency    *int                 `yaml:"targetConcurrency,omitempty"`
+	TimeoutSeconds       *int                 `yaml:"timeoutSeconds,omitempty"`
+}
+
+func parseQuantity(s string, what string) (*resource.Quantity, error) {
+	if s == "" {
+		return nil, nil
+	}
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return nil, fmt.Errorf("wrong %s quantity %s: %w", what, s, err)
+	}
+	if q.Sign() < 0 {
+		return nil, fmt.Errorf("%s quantity must not be negative", what)
+	}
+	return &q, nil
+}
+
+func parseResources(s *SerializedResources, what string) (service2.Resources, error) {
+	var res service2.Resources
+	if s == nil {
+		return res, nil
+	}
+	var err error
+	res.CPU, err = parseQuantity(s.CPU, what+" cpu")
+	if err != nil {
+		return res, err
+	}
+	res.Memory, err = parseQuantity(s.Memory, what+" memory")
+	if err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+func checkNotNegative(v *int, what string) error {
+	if v != nil && *v < 0 {
+		return fmt.Errorf("%s must not be negative", what)
+	}
+	return nil
+}
+
+func checkRequestFitsLimit(request *resource.Quantity, limit *resource.Quantity, what string) error {
+	if request != nil && limit != nil && request.Cmp(*limit) > 0 {
+		return fmt.Errorf("%s request must not exceed its limit", what)
+	}
+	return nil
+}
+
+func parseRuntime(s *SerializedRuntime) (*service2.RuntimeConfig, error) {
+	if s == nil {
+		return nil, nil
+	}
+	var err error
+	r := &service2.RuntimeConfig{
+		MinScale:             s.MinScale,
+		MaxScale:             s.MaxScale,
+		ContainerConcurrency: s.ContainerConcurrency,
+		TargetConcurrency:    s.TargetConcurrency,
+		TimeoutSeconds:       s.TimeoutSeconds,
+	}
+	r.Requests, err = parseResources(s.Requests, "requested")
+	if err != nil {
+		return nil, err
+	}
+	r.Limits, err = parseResources(s.Limits, "limited")
+	if err != nil {
+		return nil, err
+	}
+	if err := checkRequestFitsLimit(r.Requests.CPU, r.Limits.CPU, "cpu"); err != nil {
+		return nil, err
+	}
+	if err := checkRequestFitsLimit(r.Requests.Memory, r.Limits.Memory, "memory"); err != nil {
+		return nil, err
+	}
+
+	if err := checkNotNegative(r.MinScale, "minScale"); err != nil {
+		return nil, err
+	}
+	if err := checkNotNegative(r.MaxScale, "maxScale"); err != nil {
+		return nil, err
+	}
+	if err := checkNotNegative(r.ContainerConcurrency, "containerConcurrency"); err != nil {
+		return nil, err
+	}
+	// unlike the container concurrency, zero target is not a valid autoscaler setting
+	if r.TargetConcurrency != nil && *r.TargetConcurrency < 1 {
+		return nil, fmt.Errorf("targetConcurrency must be at least 1")
+	}
+	// zero max scale stands for unlimited
+	if r.MinScale != nil && r.MaxScale != nil && *r.MaxScale > 0 && *r.MinScale > *r.MaxScale {
+		return nil, fmt.Errorf("minScale must not exceed maxScale")
+	}
+	// zero container concurrency stands for unlimited
+	if r.TargetConcurrency != nil && r.ContainerConcurrency != nil &&
+		*r.ContainerConcurrency > 0 && *r.TargetConcurrency > *r.ContainerConcurrency {
+		return nil, fmt.Errorf("targetConcurrency must not exceed containerConcurrency")
+	}
+	if r.TimeoutSeconds != nil && *r.TimeoutSeconds <= 0 {
+		return nil, fmt.Errorf("timeoutSeconds must be positive")
+	}
+	return r, nil
+}
+
+func processQuantity(q *resource.Quantity) string {
+	if q == nil {
+		return ""
+	}
+	return q.String()
+}
+
+func processResources(r service2.Resources) *SerializedResources {
+	if r.CPU == nil && r.Memory == nil {
+		return nil
+	}
+	return &SerializedResources{
+		CPU:    processQuantity(r.CPU),
+		Memory: processQuantity(r.Memory),
+	}
+}
+
+func processRuntime(r *service2.RuntimeConfig) *SerializedRuntime {
+	if r == nil {
+		return nil
+	}
+	return &SerializedRuntime{
+		Requests:             processResources(r.Requests),
+		Limits:               processResources(r.Limits),
+		MinScale:             r.MinScale,
+		MaxScale:             r.MaxScale,
+		ContainerConcurrency: r.ContainerConcurrency,
+		TargetConcurrency:    r.TargetConcurrency,
+		TimeoutSeconds:       r.TimeoutSeconds,
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	service2 "github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/signature"
+)
+
+type SerializedSigning struct {
+	PublicKeys []string `yaml:"publicKeys,omitempty"`
+}
+
+func parseSigning(s *SerializedSigning) (*service2.SigningConfig, error) {
+	if s == nil {
+		return nil, nil
+	}
+	var res service2.SigningConfig
+	for i, k := range s.PublicKeys {
+		key, err := signature.ParsePublicKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("wrong public key #%d: %w", i+1, err)
+		}
+		res.PublicKeys = append(res.PublicKeys, key)
+	}
+	return &res, nil
+}
+
+func processSigning(c *service2.SigningConfig) (*SerializedSigning, error) {
+	if c == nil {
+		return nil, nil
+	}
+	var res SerializedSigning
+	for _, k := range c.PublicKeys {
+		s, err := signature.EncodePublicKey(k)
+		if err != nil {
+			return nil, err
+		}
+		res.PublicKeys = append(res.PublicKeys, s)
+	}
+	return &res, nil
+}
@@ -9,6 +9,9 @@ import (
 	"strings"
 )
 
+// ErrNoProject is returned when no directory up the hierarchy contains a project config
+var ErrNoProject = errors.New("no project found in file hierarchy")
+
 func SetupCwd(cwd string) (string, error) {
 	d, err := os.Getwd()
 	if err != nil {
@@ -34,5 +37,5 @@ func SetupCwd(cwd string) (string, error) {
 			return res, nil
 		}
 	}
-	return "", fmt.Errorf("no project found in file hierarchy")
+	return "", ErrNoProject
 }
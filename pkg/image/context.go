@@ -0,0 +1,130 @@
+package image
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"github.com/docker/docker/pkg/fileutils"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContextHashLabel marks images with the hash of the build context they were built from
+const ContextHashLabel = "chill.cloud/context-hash"
+
+const dockerignoreName = ".dockerignore"
+
+// ContextExcludes returns patterns of .dockerignore in the build context; the Dockerfile and
+// .dockerignore itself are always kept, the same way the Docker CLI does
+func ContextExcludes(dir string, dockerfile string) ([]string, error) {
+	f, err := os.Open(filepath.Join(dir, dockerignoreName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	excludes, err := readDockerignore(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", dockerignoreName, err)
+	}
+	if len(excludes) == 0 {
+		return nil, nil
+	}
+	return append(excludes, "!"+filepath.ToSlash(dockerfile), "!"+dockerignoreName), nil
+}
+
+// readDockerignore parses patterns following the rules of the Docker CLI: comments and blank
+// lines are skipped, patterns are cleaned and made relative to the context
+func readDockerignore(r io.Reader) ([]string, error) {
+	var excludes []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		pattern := strings.TrimSpace(scanner.Text())
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		invert := strings.HasPrefix(pattern, "!")
+		if invert {
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+		if len(pattern) > 0 {
+			pattern = filepath.Clean(pattern)
+			pattern = filepath.ToSlash(pattern)
+			if len(pattern) > 1 && pattern[0] == '/' {
+				pattern = pattern[1:]
+			}
+		}
+		if invert {
+			pattern = "!" + pattern
+		}
+		excludes = append(excludes, pattern)
+	}
+	return excludes, scanner.Err()
+}
+
+// ContextHash hashes paths, modes and contents of the files sent as the build context along with
+// the build settings; modification times are ignored, so only actual changes produce a new hash
+func ContextHash(dir string, excludes []string, settings ...string) (string, error) {
+	pm, err := fileutils.NewPatternMatcher(excludes)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	for _, s := range settings {
+		_, _ = fmt.Fprintf(h, "setting %d %s\x00", len(s), s)
+	}
+	// Files are walked in lexical order, so the hash does not depend on the file system
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		skip, err := pm.Matches(rel)
+		if err != nil {
+			return err
+		}
+		if skip {
+			// Files of an excluded directory might be included back by a later pattern
+			if info.IsDir() && !pm.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		_, _ = fmt.Fprintf(h, "file %s %o\x00", filepath.ToSlash(rel), info.Mode())
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, _ = fmt.Fprintf(h, "%d %s\x00", len(target), target)
+		case info.Mode().IsRegular():
+			_, _ = fmt.Fprintf(h, "%d ", info.Size())
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, f)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to hash build context: %w", err)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil)), nil
+}
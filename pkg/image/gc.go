@@ -0,0 +1,131 @@
+package image
+
+import (
+	"errors"
+	"fmt"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// VersionOfTag returns the version the tag belongs to: either the version tag itself or the tag
+// of one of its platform images; nil if the tag is not owned by any version
+func VersionOfTag(tag string) *version.Version {
+	parts := strings.SplitN(tag, "-", 2)
+	v, err := version.ParseFromString(parts[0])
+	if err != nil || v.String() != parts[0] {
+		return nil
+	}
+	if len(parts) > 1 && parts[1] == "" {
+		return nil
+	}
+	return v
+}
+
+// SupersededVersions selects development versions to delete, oldest first: the newest keep versions
+// of each minor version are left along with the protected ones; production versions are never selected
+func SupersededVersions(versions []version.Version, protected map[version.Version]bool, keep int) []version.Version {
+	sorted := make([]version.Version, len(versions))
+	copy(sorted, versions)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[j].Compare(sorted[i]) < 0
+	})
+	kept := map[version.Version]int{}
+	var res []version.Version
+	for _, v := range sorted {
+		if version.IsProduction(v) || protected[v] {
+			continue
+		}
+		line := version.Version{Major: v.Major, Minor: v.Minor}
+		if kept[line] < keep {
+			kept[line]++
+			continue
+		}
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Compare(res[j]) < 0
+	})
+	return res
+}
+
+// ListTags returns all tags of the repository, none if it does not exist
+func ListTags(repository string, auth authn.Authenticator) ([]string, error) {
+	repo, err := name.NewRepository(repository)
+	if err != nil {
+		return nil, fmt.Errorf("wrong repository %s: %w", repository, err)
+	}
+	tags, err := remote.List(repo, remote.WithAuth(auth))
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to list tags of %s: %w", repository, err)
+	}
+	return tags, nil
+}
+
+// Children returns digests of the platform images listed by the index the tag points to;
+// none if the tag points to an image or does not exist
+func Children(tag string, auth authn.Authenticator) ([]string, error) {
+	ref, err := name.NewTag(tag)
+	if err != nil {
+		return nil, fmt.Errorf("wrong image tag %s: %w", tag, err)
+	}
+	desc, err := remote.Get(ref, remote.WithAuth(auth))
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to query image %s: %w", tag, err)
+	}
+	if !desc.MediaType.IsIndex() {
+		return nil, nil
+	}
+	idx, err := desc.ImageIndex()
+	if err != nil {
+		return nil, err
+	}
+	m, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, d := range m.Manifests {
+		res = append(res, d.Digest.String())
+	}
+	return res, nil
+}
+
+// Delete removes the manifest with the digest from the repository along with its tags; some registries
+// refuse to delete manifests which are still tagged, others only delete by digest, so both are tried
+func Delete(repository string, digest string, tags []string, auth authn.Authenticator) error {
+	for _, t := range tags {
+		tag, err := name.NewTag(fmt.Sprintf("%s:%s", repository, t))
+		if err != nil {
+			return fmt.Errorf("wrong image tag %s: %w", t, err)
+		}
+		_ = remote.Delete(tag, remote.WithAuth(auth))
+	}
+	ref, err := name.NewDigest(fmt.Sprintf("%s@%s", repository, digest))
+	if err != nil {
+		return fmt.Errorf("wrong image digest %s: %w", digest, err)
+	}
+	err = remote.Delete(ref, remote.WithAuth(auth))
+	var transportErr *transport.Error
+	if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+		// The registry has deleted the manifest along with its last tag
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to delete %s: %w", ref.String(), err)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+// Package image assembles and pushes images without a Docker daemon
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Pull fetches the image from its registry; options might select the platform of an index
+func Pull(ref string, auth authn.Authenticator, opts ...remote.Option) (v1.Image, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return nil, fmt.Errorf("wrong image reference %s: %w", ref, err)
+	}
+	img, err := remote.Image(r, append(opts, remote.WithAuth(auth))...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to pull image %s: %w", ref, err)
+	}
+	return img, nil
+}
+
+// ArtifactsLayer packs the directory into a layer placing its contents at the destination;
+// modification times are dropped, so the same artifacts always produce the same layer
+func ArtifactsLayer(dir string, destination string) (v1.Layer, error) {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			header.Linkname, err = os.Readlink(p)
+			if err != nil {
+				return err
+			}
+		}
+		header.Name = strings.TrimPrefix(path.Join(destination, filepath.ToSlash(rel)), "/")
+		header.ModTime = time.Time{}
+		header.Uname, header.Gname = "", ""
+		err = w.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(w, f)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to pack artifacts: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	return tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+}
+
+// Assemble appends a layer of the artifacts to the base image
+func Assemble(base v1.Image, dir string, destination string) (v1.Image, error) {
+	layer, err := ArtifactsLayer(dir, destination)
+	if err != nil {
+		return nil, err
+	}
+	return mutate.AppendLayers(base, layer)
+}
+
+// Load reads the image from an OCI layout directory, an OCI layout archive or a `docker save` tarball;
+// the returned function removes temporary files once the image is not needed anymore
+func Load(p string) (v1.Image, func(), error) {
+	noop := func() {}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, noop, err
+	}
+	if info.IsDir() {
+		img, err := fromLayout(p)
+		return img, noop, err
+	}
+
+	isLayout, err := isLayoutArchive(p)
+	if err != nil {
+		return nil, noop, err
+	}
+	if !isLayout {
+		img, err := tarball.ImageFromPath(p, nil)
+		if err != nil {
+			return nil, noop, fmt.Errorf("unable to read tarball %s: %w", p, err)
+		}
+		return img, noop, nil
+	}
+	dir, err := os.MkdirTemp("", "chill-oci-")
+	if err != nil {
+		return nil, noop, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	err = extract(p, dir)
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	img, err := fromLayout(dir)
+	if err != nil {
+		cleanup()
+		return nil, noop, err
+	}
+	return img, cleanup, nil
+}
+
+// fromLayout returns the only image of the OCI layout
+func fromLayout(dir string) (v1.Image, error) {
+	idx, err := layout.ImageIndexFromPath(dir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read OCI layout %s: %w", dir, err)
+	}
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	if len(manifest.Manifests) != 1 {
+		return nil, fmt.Errorf("OCI layout %s must contain exactly one image, found %d", dir, len(manifest.Manifests))
+	}
+	return idx.Image(manifest.Manifests[0].Digest)
+}
+
+func isLayoutArchive(p string) (bool, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	r := tar.NewReader(f)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("unable to read archive %s: %w", p, err)
+		}
+		if path.Clean(header.Name) == "oci-layout" {
+			return true, nil
+		}
+	}
+}
+
+func extract(p string, dir string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := tar.NewReader(f)
+	for {
+		header, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read archive %s: %w", p, err)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+header.Name)))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, os.ModePerm)
+		case tar.TypeReg:
+			err = writeFile(target, r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(target string, r io.Reader) error {
+	err := os.MkdirAll(filepath.Dir(target), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// WithLabels sets labels of the image config, keeping the inherited ones
+func WithLabels(img v1.Image, labels map[string]string) (v1.Image, error) {
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	c := cfg.Config.DeepCopy()
+	if c.Labels == nil {
+		c.Labels = map[string]string{}
+	}
+	for k, v := range labels {
+		c.Labels[k] = v
+	}
+	return mutate.Config(img, *c)
+}
+
+// RemoteDigest returns the digest the tag points to in the registry, empty if there is no such tag
+func RemoteDigest(tag string, auth authn.Authenticator) (string, error) {
+	ref, err := name.NewTag(tag)
+	if err != nil {
+		return "", fmt.Errorf("wrong image tag %s: %w", tag, err)
+	}
+	desc, err := remote.Head(ref, remote.WithAuth(auth))
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return "", nil
+		}
+		return "", fmt.Errorf("unable to query image %s: %w", tag, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+// Exists reports whether the registry has the manifest the reference points to
+func Exists(ref string, auth authn.Authenticator) (bool, error) {
+	r, err := name.ParseReference(ref)
+	if err != nil {
+		return false, fmt.Errorf("wrong image reference %s: %w", ref, err)
+	}
+	_, err = remote.Head(r, remote.WithAuth(auth))
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to query image %s: %w", ref, err)
+	}
+	return true, nil
+}
+
+// Artifact is either an image or an index of images
+type Artifact interface {
+	Digest() (v1.Hash, error)
+	MediaType() (types.MediaType, error)
+	RawManifest() ([]byte, error)
+}
+
+// Index combines images built for different platforms; platforms go in the same order as images
+func Index(images []v1.Image, platforms []string, annotations map[string]string) (v1.ImageIndex, error) {
+	idx := mutate.IndexMediaType(empty.Index, types.OCIImageIndex)
+	for i, img := range images {
+		platform, err := v1.ParsePlatform(platforms[i])
+		if err != nil {
+			return nil, err
+		}
+		idx = mutate.AppendManifests(idx, mutate.IndexAddendum{
+			Add:        img,
+			Descriptor: v1.Descriptor{Platform: platform},
+		})
+	}
+	if len(annotations) > 0 {
+		annotated, ok := mutate.Annotations(idx, annotations).(v1.ImageIndex)
+		if !ok {
+			return nil, fmt.Errorf("unable to annotate the image index")
+		}
+		idx = annotated
+	}
+	return idx, nil
+}
+
+// Push uploads the image or the index under all the tags and returns its digest; options
+// only apply to the upload under the first tag
+func Push(a Artifact, tags []string, auth authn.Authenticator, opts ...remote.Option) (string, error) {
+	digest, err := a.Digest()
+	if err != nil {
+		return "", err
+	}
+	for i, t := range tags {
+		ref, err := name.NewTag(t)
+		if err != nil {
+			return "", fmt.Errorf("wrong image tag %s: %w", t, err)
+		}
+		if i > 0 {
+			// Blobs are uploaded already, so only the manifest is tagged
+			err = remote.Tag(ref, a, remote.WithAuth(auth))
+		} else if idx, ok := a.(v1.ImageIndex); ok {
+			err = remote.WriteIndex(ref, idx, append(opts, remote.WithAuth(auth))...)
+		} else if img, ok := a.(v1.Image); ok {
+			err = remote.Write(ref, img, append(opts, remote.WithAuth(auth))...)
+		} else {
+			err = fmt.Errorf("unknown type of artifact")
+		}
+		if err != nil {
+			return "", fmt.Errorf("unable to push image %s: %w", t, err)
+		}
+	}
+	return digest.String(), nil
+}
+
+// RemoteLabels returns labels of the image the tag points to in the registry, or annotations
+// if it is an index, along with its digest; nil if there is no such tag
+func RemoteLabels(tag string, auth authn.Authenticator) (map[string]string, string, error) {
+	ref, err := name.NewTag(tag)
+	if err != nil {
+		return nil, "", fmt.Errorf("wrong image tag %s: %w", tag, err)
+	}
+	desc, err := remote.Get(ref, remote.WithAuth(auth))
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return nil, "", nil
+		}
+		return nil, "", fmt.Errorf("unable to query image %s: %w", tag, err)
+	}
+	var labels map[string]string
+	if desc.MediaType.IsIndex() {
+		idx, err := desc.ImageIndex()
+		if err != nil {
+			return nil, "", err
+		}
+		m, err := idx.IndexManifest()
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read manifest of index %s: %w", tag, err)
+		}
+		labels = m.Annotations
+	} else {
+		img, err := desc.Image()
+		if err != nil {
+			return nil, "", err
+		}
+		cfg, err := img.ConfigFile()
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read config of image %s: %w", tag, err)
+		}
+		labels = cfg.Config.Labels
+	}
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	return labels, desc.Digest.String(), nil
+}
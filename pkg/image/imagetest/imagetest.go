@@ -0,0 +1,30 @@
+package imagetest
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// NewRegistry starts an in-process registry living until the end of the test and returns its host
+func NewRegistry(t *testing.T) string {
+	server := httptest.NewServer(registry.New())
+	t.Cleanup(server.Close)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
+
+// ProjectConfig describes version v1.2.0 of the demo service pushed to the registry
+func ProjectConfig(host string) *service.ProjectConfig {
+	return &service.ProjectConfig{
+		Name:           "demo",
+		Registry:       host + "/team",
+		CurrentVersion: &version.Version{Major: 1, Minor: 2},
+	}
+}
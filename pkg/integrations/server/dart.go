@@ -14,6 +14,10 @@ func (g *dartIntegration) GetBaseProjectRemote() string {
 	return "github.com/chill-cloud/base-project-dart"
 }
 
+func (g *dartIntegration) ImplementsHealthCheck() bool {
+	return false
+}
+
 func init() {
 	Register("dart", &dartIntegration{})
 }
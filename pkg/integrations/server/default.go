@@ -16,6 +16,10 @@ func (g *defaultIntegration) GetBaseProjectRemote() string {
 	return "github.com/chill-cloud/base-project-default"
 }
 
+func (g *defaultIntegration) ImplementsHealthCheck() bool {
+	return false
+}
+
 func init() {
 	Register(DefaultServerName, &defaultIntegration{})
 }
@@ -66,6 +66,10 @@ func (g *goIntegration) GetBaseProjectRemote() string {
 	return "github.com/chill-cloud/base-project-go"
 }
 
+func (g *goIntegration) ImplementsHealthCheck() bool {
+	return true
+}
+
 func init() {
 	Register("go", &goIntegration{})
 }
@@ -14,6 +14,10 @@ func (g *pythonIntegration) GetBaseProjectRemote() string {
 	return "github.com/chill-cloud/base-project-python"
 }
 
+func (g *pythonIntegration) ImplementsHealthCheck() bool {
+	return false
+}
+
 func init() {
 	Register("python", &pythonIntegration{})
 }
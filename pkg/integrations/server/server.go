@@ -5,6 +5,8 @@ const DefaultServerName = "default"
 type Integration interface {
 	GenerateMethods(cwd string, name string, protoSource string) error
 	GetBaseProjectRemote() string
+	// ImplementsHealthCheck reports whether the base project serves grpc.health.v1 and ships grpc_health_probe
+	ImplementsHealthCheck() bool
 }
 
 var serverIntegrationMap = map[string]Integration{}
@@ -0,0 +1,68 @@
+// Package progress renders progress of image builds and pushes
+package progress
+
+import (
+	"encoding/json"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/moby/term"
+	"io"
+)
+
+// Render displays a Docker JSON message stream: per-layer progress bars on a terminal and
+// plain lines otherwise, e.g. in CI. Errors reported by the stream are returned
+func Render(in io.Reader, out io.Writer) error {
+	fd, isTerminal := term.GetFdInfo(out)
+	return jsonmessage.DisplayJSONMessagesStream(in, out, fd, isTerminal, nil)
+}
+
+// RenderPush displays a push stream of the Docker daemon like Render does and returns
+// the digests the daemon reports for the pushed tags
+func RenderPush(in io.Reader, out io.Writer) (map[string]string, error) {
+	digests := map[string]string{}
+	fd, isTerminal := term.GetFdInfo(out)
+	err := jsonmessage.DisplayJSONMessagesStream(in, out, fd, isTerminal, func(jm jsonmessage.JSONMessage) {
+		var result types.PushResult
+		if jm.Aux != nil && json.Unmarshal(*jm.Aux, &result) == nil && result.Digest != "" {
+			digests[result.Tag] = result.Digest
+		}
+	})
+	return digests, err
+}
+
+// FromUpdates converts progress updates of a registry client to a Docker JSON message stream,
+// so both are rendered the same way; the stream ends when the updates channel is closed.
+// The reader must be closed, otherwise the sender of updates might get blocked
+func FromUpdates(id string, status string, updates <-chan v1.Update) io.ReadCloser {
+	r, w := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(w)
+		var err error
+		for u := range updates {
+			// Updates are still drained after the reader is gone
+			if err != nil {
+				continue
+			}
+			jm := jsonmessage.JSONMessage{ID: id, Status: status}
+			if u.Error != nil {
+				jm.Error = &jsonmessage.JSONError{Message: u.Error.Error()}
+			} else {
+				jm.Progress = &jsonmessage.JSONProgress{Current: u.Complete, Total: u.Total}
+			}
+			err = enc.Encode(jm)
+		}
+		_ = w.Close()
+	}()
+	return r
+}
+
+// RenderUpdates displays progress updates of a registry client until the channel is closed.
+// The stream is closed once the first error is rendered, so later updates are discarded
+// instead of blocking the sender
+func RenderUpdates(id string, status string, updates <-chan v1.Update, out io.Writer) error {
+	stream := FromUpdates(id, status, updates)
+	err := Render(stream, out)
+	_ = stream.Close()
+	return err
+}
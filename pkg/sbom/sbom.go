@@ -0,0 +1,260 @@
+// Package sbom describes images of services as SPDX documents
+package sbom
+
+import (
+	"archive/tar"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const noAssertion = "NOASSERTION"
+
+type Checksum struct {
+	Algorithm string `json:"algorithm"`
+	Value     string `json:"checksumValue"`
+}
+
+type VerificationCode struct {
+	Value string `json:"packageVerificationCodeValue"`
+}
+
+type ExternalRef struct {
+	Category string `json:"referenceCategory"`
+	Type     string `json:"referenceType"`
+	Locator  string `json:"referenceLocator"`
+}
+
+type Package struct {
+	ID               string            `json:"SPDXID"`
+	Name             string            `json:"name"`
+	Version          string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	VerificationCode *VerificationCode `json:"packageVerificationCode,omitempty"`
+	Checksums        []Checksum        `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	Comment          string            `json:"comment,omitempty"`
+	ExternalRefs     []ExternalRef     `json:"externalRefs,omitempty"`
+	HasFiles         []string          `json:"hasFiles,omitempty"`
+}
+
+type File struct {
+	ID               string     `json:"SPDXID"`
+	Name             string     `json:"fileName"`
+	Checksums        []Checksum `json:"checksums"`
+	LicenseConcluded string     `json:"licenseConcluded"`
+	CopyrightText    string     `json:"copyrightText"`
+}
+
+type Relationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+type CreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+	Comment  string   `json:"comment,omitempty"`
+}
+
+// Document is an SPDX 2.2 document in its JSON form
+type Document struct {
+	Version       string         `json:"spdxVersion"`
+	DataLicense   string         `json:"dataLicense"`
+	ID            string         `json:"SPDXID"`
+	Name          string         `json:"name"`
+	Namespace     string         `json:"documentNamespace"`
+	CreationInfo  CreationInfo   `json:"creationInfo"`
+	Packages      []Package      `json:"packages"`
+	Files         []File         `json:"files,omitempty"`
+	Relationships []Relationship `json:"relationships"`
+}
+
+// Image is a built image of the service
+type Image struct {
+	Ref string
+	// Platform is empty for the native one
+	Platform string
+	Image    v1.Image
+}
+
+// Dependency is a service the image depends on at the locked version
+type Dependency struct {
+	Name    string
+	Version string
+	// Location is the git remote, empty for local dependencies
+	Location string
+}
+
+// Provenance tells how the images were built
+type Provenance struct {
+	Builder     string
+	Revision    string
+	ContextHash string
+}
+
+// spdxID makes an identifier out of arbitrary text, which might only contain letters, numbers, dots and dashes
+func spdxID(kind string, parts ...string) string {
+	id := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.Join(parts, "-"))
+	return fmt.Sprintf("SPDXRef-%s-%s", kind, id)
+}
+
+// imageFiles lists regular files of the image filesystem with their checksums, sorted by name
+func imageFiles(img v1.Image) ([]File, error) {
+	r := mutate.Extract(img)
+	defer r.Close()
+	var files []File
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read image filesystem: %w", err)
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		s1, s256 := sha1.New(), sha256.New()
+		_, err = io.Copy(io.MultiWriter(s1, s256), tr)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read %s: %w", h.Name, err)
+		}
+		name := "./" + strings.TrimPrefix(path.Clean("/"+h.Name), "/")
+		files = append(files, File{
+			Name: name,
+			Checksums: []Checksum{
+				{Algorithm: "SHA1", Value: hex.EncodeToString(s1.Sum(nil))},
+				{Algorithm: "SHA256", Value: hex.EncodeToString(s256.Sum(nil))},
+			},
+			LicenseConcluded: noAssertion,
+			CopyrightText:    noAssertion,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// verificationCode follows the SPDX algorithm: SHA1 of the sorted SHA1 checksums of all the files
+func verificationCode(files []File) *VerificationCode {
+	var sums []string
+	for _, f := range files {
+		sums = append(sums, f.Checksums[0].Value)
+	}
+	sort.Strings(sums)
+	h := sha1.Sum([]byte(strings.Join(sums, "")))
+	return &VerificationCode{Value: hex.EncodeToString(h[:])}
+}
+
+// Generate describes files of the images and the locked dependencies of the service
+func Generate(name string, version string, images []Image, deps []Dependency, p Provenance) (*Document, error) {
+	doc := &Document{
+		Version:     "SPDX-2.2",
+		DataLicense: "CC0-1.0",
+		ID:          "SPDXRef-DOCUMENT",
+		Name:        fmt.Sprintf("%s-%s", name, version),
+		CreationInfo: CreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + p.Builder},
+			Comment: fmt.Sprintf("Built from revision %s with build context hash %s",
+				valueOrUnknown(p.Revision), valueOrUnknown(p.ContextHash)),
+		},
+		Relationships: []Relationship{},
+	}
+	var imageIDs []string
+	for _, img := range images {
+		digest, err := img.Image.Digest()
+		if err != nil {
+			return nil, err
+		}
+		id := spdxID("Image", name, version, img.Platform)
+		files, err := imageFiles(img.Image)
+		if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			// Paths are not safe to use, as they might map to the same identifier
+			files[i].ID = fmt.Sprintf("%s-File-%d", id, i)
+		}
+		pkg := Package{
+			ID:               id,
+			Name:             img.Ref,
+			Version:          version,
+			DownloadLocation: noAssertion,
+			FilesAnalyzed:    true,
+			VerificationCode: verificationCode(files),
+			Checksums:        []Checksum{{Algorithm: "SHA256", Value: digest.Hex}},
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+			Comment:          img.Platform,
+		}
+		for _, f := range files {
+			pkg.HasFiles = append(pkg.HasFiles, f.ID)
+		}
+		doc.Packages = append(doc.Packages, pkg)
+		doc.Files = append(doc.Files, files...)
+		doc.Relationships = append(doc.Relationships, Relationship{Element: doc.ID, Type: "DESCRIBES", Related: id})
+		imageIDs = append(imageIDs, id)
+		if len(imageIDs) == 1 {
+			// Images of the version are unique by their digests
+			doc.Namespace = fmt.Sprintf("https://chill.cloud/spdx/%s/%s/%s", name, version, digest.Hex)
+		}
+	}
+	if doc.Namespace == "" {
+		return nil, fmt.Errorf("no images to describe")
+	}
+
+	sort.Slice(deps, func(i, j int) bool {
+		return deps[i].Name < deps[j].Name
+	})
+	for _, d := range deps {
+		id := spdxID("Service", d.Name, d.Version)
+		location := noAssertion
+		if d.Location != "" {
+			location = "git+" + d.Location
+		}
+		doc.Packages = append(doc.Packages, Package{
+			ID:               id,
+			Name:             d.Name,
+			Version:          d.Version,
+			DownloadLocation: location,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+			Comment:          "Chill service the image calls at runtime",
+		})
+		for _, imageID := range imageIDs {
+			doc.Relationships = append(doc.Relationships, Relationship{Element: imageID, Type: "DEPENDS_ON", Related: id})
+		}
+	}
+	return doc, nil
+}
+
+func valueOrUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
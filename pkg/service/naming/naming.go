@@ -52,6 +52,23 @@ func SecretToMountPath(key string) string {
 	return fmt.Sprintf("/etc/chill/secret/%s", key)
 }
 
+const ConfigMountPath = "/etc/chill/config"
+
+var envRe = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// ValidateEnv checks that the name might be used as an environment variable
+func ValidateEnv(name string) bool {
+	return envRe.Match([]byte(name))
+}
+
+// IsReservedEnv reports whether the environment variable is managed by Chill itself
+func IsReservedEnv(name string) bool {
+	return name == "CHILL_SELF_NAME" ||
+		name == "CHILL_SELF_VERSION" ||
+		strings.HasPrefix(name, "CHILL_SERVICE_") ||
+		strings.HasPrefix(name, "CHILL_SECRET_")
+}
+
 func capitalizeFirst(s string) string {
 	r := []rune(s)
 	r[0] = unicode.ToUpper(r[0])
@@ -1,9 +1,13 @@
 package service
 
 import (
+	"crypto/ed25519"
 	"fmt"
 	"github.com/chill-cloud/chill-cli/pkg/cache"
 	"github.com/chill-cloud/chill-cli/pkg/version"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"strings"
+	"text/template"
 )
 
 type Stage int
@@ -34,6 +38,120 @@ type IncrementalConfig interface {
 	ApplyIdempotent(c *ProjectConfig) error
 }
 
+// Resources holds compute resources of a container; nil means the cluster default
+type Resources struct {
+	CPU    *resource.Quantity
+	Memory *resource.Quantity
+}
+
+// RuntimeConfig describes how revisions of the service are scaled and limited
+type RuntimeConfig struct {
+	Requests             Resources
+	Limits               Resources
+	MinScale             *int
+	MaxScale             *int
+	ContainerConcurrency *int
+	TargetConcurrency    *int
+	TimeoutSeconds       *int
+}
+
+type ProbeType string
+
+const (
+	// ProbeGRPC runs grpc_health_probe of the image, the default of integrations serving grpc.health.v1
+	ProbeGRPC ProbeType = "grpc"
+	ProbeHTTP ProbeType = "http"
+	ProbeTCP  ProbeType = "tcp"
+	ProbeExec ProbeType = "exec"
+	ProbeNone ProbeType = "none"
+)
+
+// Probe describes a health check of the service container
+type Probe struct {
+	Type                ProbeType
+	Path                string
+	Command             []string
+	GRPCService         string
+	InitialDelaySeconds *int
+	PeriodSeconds       *int
+	TimeoutSeconds      *int
+	FailureThreshold    *int
+}
+
+// ProbesConfig holds container probes; nil probes are defaulted by the integration
+type ProbesConfig struct {
+	Liveness  *Probe
+	Readiness *Probe
+}
+
+const (
+	DefaultDockerfile   = "image/Dockerfile"
+	DefaultBuildContext = "."
+)
+
+// BuildConfig describes how the image of the service is built; paths are relative to the project root,
+// build args and tags are templates. If platforms are set, an image is built for each of them
+// and the version tag refers to an index of these images
+type BuildConfig struct {
+	Dockerfile string
+	Context    string
+	Args       map[string]string
+	Target     string
+	Tags       []string
+	Platforms  []string
+}
+
+// BuildTemplateData is everything templates of the build settings might refer to;
+// secrets are never exposed, so they cannot be baked into images
+type BuildTemplateData struct {
+	Name    string
+	Version string
+}
+
+// RenderBuildTemplate expands the template of a build arg or a tag
+func RenderBuildTemplate(s string, data BuildTemplateData) (string, error) {
+	t, err := template.New("build").Option("missingkey=error").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	err = t.Execute(&out, data)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// DefaultLocalRegistry is the prefix Knative never resolves to digests
+const DefaultLocalRegistry = "dev.local"
+
+// LocalRegistry is the prefix of images loaded to a local cluster, it depends on the chosen loader
+var LocalRegistry = DefaultLocalRegistry
+
+// LocalConfig selects how images built locally reach a local cluster; empty values are defaulted
+type LocalConfig struct {
+	Loader          string
+	Registry        string
+	MinikubeProfile string
+	KindCluster     string
+}
+
+// SigningConfig lists keys trusted to sign images of the service
+type SigningConfig struct {
+	PublicKeys []ed25519.PublicKey
+}
+
+// Environment holds settings overridden when deploying into a named environment;
+// empty values are inherited from the project and the global flags
+type Environment struct {
+	KubeContext    string
+	Namespace      string
+	Registry       string
+	Backend        string
+	TrafficTargets map[version.Version]int
+	Config         map[string]string
+}
+
 type ProjectConfig struct {
 	Name           string
 	Registry       string
@@ -45,6 +163,14 @@ type ProjectConfig struct {
 	Dependencies   map[Dependency]bool
 	TrafficTargets map[version.Version]int
 	Secrets        []string
+	Runtime        *RuntimeConfig
+	Probes         *ProbesConfig
+	Build          *BuildConfig
+	Local          *LocalConfig
+	Signing        *SigningConfig
+	ImageDigest    string
+	Config         map[string]string
+	Environments   map[string]Environment
 }
 
 func (pc *ProjectConfig) GetTrafficTargets() (map[version.Version]int, error) {
@@ -60,12 +186,75 @@ func (pc *ProjectConfig) GetTrafficTargets() (map[version.Version]int, error) {
 	}
 }
 
+// GetBuild returns build settings with the defaults filled
+func (pc *ProjectConfig) GetBuild() BuildConfig {
+	var res BuildConfig
+	if pc.Build != nil {
+		res = *pc.Build
+	}
+	if res.Dockerfile == "" {
+		res.Dockerfile = DefaultDockerfile
+	}
+	if res.Context == "" {
+		res.Context = DefaultBuildContext
+	}
+	return res
+}
+
+// GetConfig returns plain configuration values with overrides of the environment applied
+func (pc *ProjectConfig) GetConfig(env string) (map[string]string, error) {
+	res := map[string]string{}
+	for k, v := range pc.Config {
+		res[k] = v
+	}
+	e, err := pc.GetEnvironment(env)
+	if err != nil {
+		return nil, err
+	}
+	if e != nil {
+		for k, v := range e.Config {
+			res[k] = v
+		}
+	}
+	return res, nil
+}
+
+// GetEnvironment returns settings of the named environment, nil for the default one; an environment
+// the project does not declare is the default one too, as dependencies are deployed into environments
+// of their dependents
+func (pc *ProjectConfig) GetEnvironment(env string) (*Environment, error) {
+	if env == "" {
+		return nil, nil
+	}
+	e, ok := pc.Environments[env]
+	if !ok {
+		return nil, nil
+	}
+	return &e, nil
+}
+
+// ApplyEnvironment overrides the registry and the traffic policy by the ones of the environment
+func (pc *ProjectConfig) ApplyEnvironment(env string) error {
+	e, err := pc.GetEnvironment(env)
+	if err != nil || e == nil {
+		return err
+	}
+	if e.Registry != "" {
+		pc.Registry = e.Registry
+	}
+	if e.TrafficTargets != nil {
+		pc.TrafficTargets = e.TrafficTargets
+	}
+	return nil
+}
+
 func (pc *ProjectConfig) ApplyIdempotent(c *ProjectConfig) error {
 	if c.Name != "" && pc.Name != c.Name {
 		return fmt.Errorf("it is not a good idea to rename service")
 	}
 	pc.BaseVersion = c.BaseVersion
 	pc.CurrentVersion = c.CurrentVersion
+	pc.ImageDigest = c.ImageDigest
 	if pc.TrafficTargets == nil {
 		pc.TrafficTargets = c.TrafficTargets
 	}
@@ -86,13 +275,24 @@ func (pc *ProjectConfig) GetBuildTag(forceLocal bool) (string, bool) {
 	isLocal := pc.Registry == "" || forceLocal
 	var registry string
 	if isLocal {
-		registry = "dev.local"
+		registry = LocalRegistry
 	} else {
 		registry = pc.Registry
 	}
 	return fmt.Sprintf("%s/%s:%s", registry, pc.Name, pc.CurrentVersion.String()), isLocal
 }
 
+// GetImageRef returns the image deployed for the current version: pinned by the digest recorded
+// after push, or the mutable tag if there is none; the latter is reported by false
+func (pc *ProjectConfig) GetImageRef(forceLocal bool) (string, bool) {
+	imageName, isLocal := pc.GetBuildTag(forceLocal)
+	if isLocal || pc.ImageDigest == "" {
+		return imageName, false
+	}
+	repository := imageName[:strings.LastIndex(imageName, ":")]
+	return fmt.Sprintf("%s@%s", repository, pc.ImageDigest), true
+}
+
 func (pc *ProjectConfig) UpdateDependencies(ctx cache.LocalCacheContext) error {
 	for dep := range pc.Dependencies {
 		err := dep.Cache().Update(ctx)
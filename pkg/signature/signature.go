@@ -0,0 +1,182 @@
+// Package signature signs images by their digests and verifies the signatures
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Annotation holds the base64 signature of the payload layer
+const Annotation = "chill.cloud/signature"
+
+const payloadMediaType types.MediaType = "application/vnd.chill.signature.payload.v1+json"
+
+// payload is what is actually signed: the image is identified by both the repository and the digest,
+// so a signature cannot be moved to a different repository
+type payload struct {
+	Repository string `json:"repository"`
+	Digest     string `json:"digest"`
+}
+
+func newPayload(repository string, digest string) ([]byte, error) {
+	return json.Marshal(payload{Repository: repository, Digest: digest})
+}
+
+// Tag returns the tag the signature of the image with the digest is stored under
+func Tag(repository string, digest string) (name.Tag, error) {
+	h, err := v1.NewHash(digest)
+	if err != nil {
+		return name.Tag{}, fmt.Errorf("wrong image digest %s: %w", digest, err)
+	}
+	return name.NewTag(fmt.Sprintf("%s:%s-%s.sig", repository, h.Algorithm, h.Hex))
+}
+
+// LoadPrivateKey reads a PKCS #8 PEM encoded ed25519 key, e.g. generated by
+// openssl genpkey -algorithm ed25519
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse private key %s: %w", path, err)
+	}
+	res, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %s is not an ed25519 key", path)
+	}
+	return res, nil
+}
+
+// ParsePublicKey parses a PEM encoded ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an ed25519 key")
+	}
+	return res, nil
+}
+
+// EncodePublicKey is the inverse of ParsePublicKey
+func EncodePublicKey(key ed25519.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
+
+// Sign pushes a signature of the image with the digest to the repository as an artifact
+// with the signed payload as its only layer
+func Sign(key ed25519.PrivateKey, repository string, digest string, auth authn.Authenticator) error {
+	tag, err := Tag(repository, digest)
+	if err != nil {
+		return err
+	}
+	p, err := newPayload(repository, digest)
+	if err != nil {
+		return err
+	}
+	img := mutate.MediaType(empty.Image, types.OCIManifestSchema1)
+	img, err = mutate.Append(img, mutate.Addendum{
+		Layer: static.NewLayer(p, payloadMediaType),
+		Annotations: map[string]string{
+			Annotation: base64.StdEncoding.EncodeToString(ed25519.Sign(key, p)),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	err = remote.Write(tag, img, remote.WithAuth(auth))
+	if err != nil {
+		return fmt.Errorf("unable to push signature %s: %w", tag.String(), err)
+	}
+	return nil
+}
+
+// Verify makes sure the image with the digest is signed by one of the keys
+func Verify(keys []ed25519.PublicKey, repository string, digest string, auth authn.Authenticator) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no public keys to verify signatures with")
+	}
+	tag, err := Tag(repository, digest)
+	if err != nil {
+		return err
+	}
+	img, err := remote.Image(tag, remote.WithAuth(auth))
+	if err != nil {
+		var transportErr *transport.Error
+		if errors.As(err, &transportErr) && transportErr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("image %s@%s is not signed", repository, digest)
+		}
+		return fmt.Errorf("unable to fetch signature %s: %w", tag.String(), err)
+	}
+	expected, err := newPayload(repository, digest)
+	if err != nil {
+		return err
+	}
+	m, err := img.Manifest()
+	if err != nil {
+		return err
+	}
+	for _, desc := range m.Layers {
+		sig, err := base64.StdEncoding.DecodeString(desc.Annotations[Annotation])
+		if err != nil || len(sig) == 0 {
+			continue
+		}
+		layer, err := img.LayerByDigest(desc.Digest)
+		if err != nil {
+			return err
+		}
+		rc, err := layer.Compressed()
+		if err != nil {
+			return err
+		}
+		p, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		// The payload is covered by the layer digest, so it is the one the signature is checked against
+		if !bytes.Equal(p, expected) {
+			continue
+		}
+		for _, k := range keys {
+			if ed25519.Verify(k, p, sig) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no valid signature of image %s@%s found for the trusted keys", repository, digest)
+}
@@ -7,6 +7,8 @@ import (
 	"github.com/chill-cloud/chill-cli/pkg/config"
 	"github.com/chill-cloud/chill-cli/pkg/logging"
 	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"sort"
 	"strings"
 )
 
@@ -66,59 +68,137 @@ func (c *SccContext) FindScc() [][]string {
 	return res
 }
 
-func ValidateGraph(pc *service.ProjectConfig, c cache.LocalCacheContext, forceLocal bool) error {
-	adj := map[string][]string{}
-	rev := map[string][]string{}
+// TopologicalOrder returns vertices of an acyclic graph so that every vertex
+// follows all the vertices it points to
+func (c *SccContext) TopologicalOrder() []string {
+	var vertices []string
+	for v := range c.Adj {
+		vertices = append(vertices, v)
+	}
+	sort.Strings(vertices)
+	c.order = nil
+	c.visited = map[string]bool{}
+	for _, v := range vertices {
+		if !c.visited[v] {
+			c.dfsIn(v)
+		}
+	}
+	return c.order
+}
+
+// GraphNode is a service of the dependency graph at the version locked by its dependents
+type GraphNode struct {
+	Source  cache.CachedSource
+	Version version.Version
+	Config  *service.ProjectConfig
+}
+
+func nodeKey(name string, v version.Version) string {
+	return fmt.Sprintf("%s@%s", name, v.String())
+}
+
+// walkGraph builds the dependency graph of the service failing on cycles; when locked, every dependency
+// is switched to the version locked by its dependent and services at different versions are distinct nodes
+func walkGraph(pc *service.ProjectConfig, c cache.LocalCacheContext, forceLocal bool, locked bool) (*SccContext, map[string]GraphNode, error) {
+	key := func(cfg *service.ProjectConfig) string {
+		if locked {
+			return nodeKey(cfg.Name, *cfg.CurrentVersion)
+		}
+		return cfg.Name
+	}
+	ctx := NewSccContext()
+	ctx.Adj[key(pc)] = []string{}
+	nodes := map[string]GraphNode{}
 
 	stack := list.List{}
 	stack.PushBack(pc)
-	visited := map[string]bool{}
-	adj[pc.Name] = []string{}
-	rev[pc.Name] = []string{}
 	for stack.Len() > 0 {
 		back := stack.Back()
 		cur, ok := back.Value.(*service.ProjectConfig)
 		if !ok {
-			return fmt.Errorf("wrong type")
+			return nil, nil, fmt.Errorf("wrong type")
 		}
 		stack.Remove(back)
-
-		visited[cur.Name] = true
-		logging.Logger.Info(cur.Name)
+		curKey := key(cur)
+		logging.Logger.Info(curKey)
 
 		for dep := range cur.Dependencies {
-			if !forceLocal {
-				err := dep.Cache().Update(c)
-				if err != nil {
-					return err
-				}
+			v := dep.GetSpecificVersion()
+			if locked && v == nil {
+				return nil, nil, fmt.Errorf("specific version must be set for service %s", dep.GetName())
 			}
-			cfg, err := config.ParseConfig(dep.Cache().GetPath(c), config.LockConfigName, true)
-			if err != nil {
-				return err
+			depKey := dep.GetName()
+			if locked {
+				depKey = nodeKey(dep.GetName(), *v)
 			}
-			if cfg.Name != dep.GetName() {
-				return fmt.Errorf("dependency name must follow the name specified in its config")
-			}
-			if !visited[cfg.Name] {
+			if _, ok := nodes[depKey]; !ok {
+				if !forceLocal {
+					err := dep.Cache().Update(c)
+					if err != nil {
+						return nil, nil, err
+					}
+				}
+				if locked {
+					err := dep.Cache().SwitchToVersion(c, *v)
+					if err != nil {
+						return nil, nil, fmt.Errorf("%s: unable to switch to version %s: %w", dep.GetName(), v.String(), err)
+					}
+				}
+				cfg, err := config.ParseConfig(dep.Cache().GetPath(c), config.LockConfigName, true)
+				if err != nil {
+					return nil, nil, err
+				}
+				if cfg == nil {
+					return nil, nil, fmt.Errorf("no project config found for service %s", dep.GetName())
+				}
+				if cfg.Name != dep.GetName() {
+					return nil, nil, fmt.Errorf("dependency name must follow the name specified in its config")
+				}
+				if locked && cfg.CurrentVersion.Compare(*v) != 0 {
+					return nil, nil, fmt.Errorf("service %s is locked at %s instead of %s", cfg.Name, cfg.CurrentVersion.String(), v.String())
+				}
+				node := GraphNode{Source: dep.Cache(), Config: cfg}
+				if cfg.CurrentVersion != nil {
+					node.Version = *cfg.CurrentVersion
+				}
+				nodes[depKey] = node
+				ctx.Adj[depKey] = []string{}
 				stack.PushBack(cfg)
 			}
-			adj[cur.Name] = append(adj[cur.Name], cfg.Name)
-			rev[cfg.Name] = append(rev[cfg.Name], cur.Name)
+			ctx.Adj[curKey] = append(ctx.Adj[curKey], depKey)
+			ctx.Rev[depKey] = append(ctx.Rev[depKey], curKey)
 		}
 	}
-	ctx := SccContext{Adj: adj, Rev: rev}
-	res := ctx.FindScc()
-	if len(res) != len(visited) {
-		var goodOne []string
-		for _, scc := range res {
-			if len(scc) > 1 {
-				goodOne = scc
-				break
-			}
+
+	for _, scc := range ctx.FindScc() {
+		if len(scc) > 1 {
+			return nil, nil, fmt.Errorf("cyclic dependency found; these services form a stronly connected component:\n"+
+				"%s", strings.Join(append(scc, scc[0]), " -> "))
 		}
-		return fmt.Errorf("cyclic dependency found; these services form a stronly connected component:\n"+
-			"%s", strings.Join(append(goodOne, goodOne[0]), " -> "))
 	}
-	return nil
+	return ctx, nodes, nil
+}
+
+// ResolveGraph validates the graph of the service at the locked versions of its dependencies and
+// collects them so that every dependency goes before the services depending on it; the service
+// itself is not included
+func ResolveGraph(pc *service.ProjectConfig, c cache.LocalCacheContext, forceLocal bool) ([]GraphNode, error) {
+	ctx, nodes, err := walkGraph(pc, c, forceLocal, true)
+	if err != nil {
+		return nil, err
+	}
+	root := nodeKey(pc.Name, *pc.CurrentVersion)
+	var res []GraphNode
+	for _, key := range ctx.TopologicalOrder() {
+		if key != root {
+			res = append(res, nodes[key])
+		}
+	}
+	return res, nil
+}
+
+// ValidateGraph checks that dependencies of the service match their configs and form no cycles
+func ValidateGraph(pc *service.ProjectConfig, c cache.LocalCacheContext, forceLocal bool) error {
+	_, _, err := walkGraph(pc, c, forceLocal, false)
+	return err
 }
@@ -0,0 +1,317 @@
+package test
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/config"
+	"github.com/chill-cloud/chill-cli/pkg/service"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseConfigString(t *testing.T, data string) (*service.ProjectConfig, error) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, config.ProjectConfigName), []byte(data), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config.ParseConfig(dir, config.ProjectConfigName, false)
+}
+
+func TestRuntimeConfig(t *testing.T) {
+	cfg, err := parseConfigString(t, `service:
+  name: demo
+  stage: development
+  runtime:
+    requests:
+      cpu: 100m
+      memory: 128Mi
+    limits:
+      cpu: "1"
+    minScale: 1
+    maxScale: 5
+    containerConcurrency: 10
+    targetConcurrency: 8
+    timeoutSeconds: 60
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Runtime == nil || cfg.Runtime.Requests.CPU.MilliValue() != 100 || *cfg.Runtime.MaxScale != 5 {
+		t.Fatal("runtime settings not parsed")
+	}
+	s, err := config.ProcessConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Runtime.Requests.Memory != "128Mi" || s.Runtime.Limits.Memory != "" {
+		t.Fatal("runtime settings not serialized back")
+	}
+
+	for _, bad := range []string{
+		"requests: {cpu: abc}",
+		"requests: {cpu: \"2\"}\n    limits: {cpu: \"1\"}",
+		"minScale: 3\n    maxScale: 2",
+		"containerConcurrency: 2\n    targetConcurrency: 3",
+		"targetConcurrency: 0",
+		"timeoutSeconds: 0",
+		"minScale: -1",
+	} {
+		_, err := parseConfigString(t, "service:\n  name: demo\n  runtime:\n    "+bad+"\n")
+		if err == nil {
+			t.Fatalf("invalid runtime accepted: %s", bad)
+		}
+	}
+}
+
+func TestPlainConfig(t *testing.T) {
+	cfg, err := parseConfigString(t, `service:
+  name: demo
+  secrets: [db-pass]
+  config:
+    LOG_LEVEL: info
+    FEATURE_X: "on"
+  environments:
+    staging:
+      config:
+        LOG_LEVEL: debug
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := cfg.GetConfig("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["LOG_LEVEL"] != "debug" || values["FEATURE_X"] != "on" {
+		t.Fatal("environment overrides not applied")
+	}
+	values, err = cfg.GetConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["LOG_LEVEL"] != "info" {
+		t.Fatal("base config changed by overrides")
+	}
+	values, err = cfg.GetConfig("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["LOG_LEVEL"] != "info" {
+		t.Fatal("undeclared environment must use the base config")
+	}
+
+	for _, bad := range []string{
+		"config: {CHILL_SECRET_DB_PASS: x}",
+		"config: {CHILL_SERVICE_OTHER: x}",
+		"config: {CHILL_SELF_NAME: x}",
+		"config: {1BAD: x}",
+		"environments: {staging: {config: {CHILL_SECRET_DB_PASS: x}}}",
+		"environments: {Staging: {}}",
+	} {
+		_, err := parseConfigString(t, "service:\n  name: demo\n  secrets: [db-pass]\n  "+bad+"\n")
+		if err == nil {
+			t.Fatalf("invalid config accepted: %s", bad)
+		}
+	}
+}
+
+func TestEnvironments(t *testing.T) {
+	cfg, err := parseConfigString(t, `service:
+  name: demo
+  registry: registry.example.com/dev
+  currentVersion: v1.2.0
+  environments:
+    prod:
+      kubeContext: prod-cluster
+      namespace: services
+      registry: registry.example.com/prod
+      trafficTargets:
+        v1.1.0: 90
+        v1.2.0: 10
+    staging: {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := cfg.GetEnvironment("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.KubeContext != "prod-cluster" || e.Namespace != "services" {
+		t.Fatal("wrong cluster settings")
+	}
+
+	if err := cfg.ApplyEnvironment("staging"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Registry != "registry.example.com/dev" || cfg.TrafficTargets != nil {
+		t.Fatal("empty environment must inherit project settings")
+	}
+	if err := cfg.ApplyEnvironment("prod"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Registry != "registry.example.com/prod" {
+		t.Fatal("registry not overridden")
+	}
+	targets, err := cfg.GetTrafficTargets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if targets[version.Version{Major: 1, Minor: 1}] != 90 {
+		t.Fatal("traffic policy not overridden")
+	}
+
+	_, err = parseConfigString(t, `service:
+  name: demo
+  environments:
+    prod:
+      trafficTargets: {v1.1.0: 50}
+`)
+	if err == nil {
+		t.Fatal("traffic policy not summing up to 100 accepted")
+	}
+}
+
+func TestProbesConfig(t *testing.T) {
+	cfg, err := parseConfigString(t, `service:
+  name: demo
+  probes:
+    readiness:
+      type: http
+      path: /ready
+      periodSeconds: 5
+    liveness:
+      type: none
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Probes.Readiness.Type != service.ProbeHTTP || cfg.Probes.Liveness.Type != service.ProbeNone {
+		t.Fatal("probes not parsed")
+	}
+
+	for _, bad := range []string{
+		"readiness: {type: magic}",
+		"readiness: {type: http, path: ready}",
+		"liveness: {type: exec}",
+		"liveness: {type: grpc, periodSeconds: 0}",
+	} {
+		_, err := parseConfigString(t, "service:\n  name: demo\n  probes:\n    "+bad+"\n")
+		if err == nil {
+			t.Fatalf("invalid probe accepted: %s", bad)
+		}
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	cfg, err := parseConfigString(t, `service:
+  name: demo
+  stage: development
+  build:
+    dockerfile: docker/Dockerfile
+    args:
+      APP: "{{ .Name }}-{{ .Version }}"
+    target: release
+    tags: [latest]
+    platforms: [linux/amd64, linux/arm64/v8]
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	build := cfg.GetBuild()
+	if build.Dockerfile != "docker/Dockerfile" || build.Context != service.DefaultBuildContext || build.Target != "release" ||
+		len(build.Platforms) != 2 {
+		t.Fatal("build settings not parsed")
+	}
+	arg, err := service.RenderBuildTemplate(build.Args["APP"], service.BuildTemplateData{Name: "demo", Version: "1.2.0"})
+	if err != nil || arg != "demo-1.2.0" {
+		t.Fatalf("build arg rendered as %s: %v", arg, err)
+	}
+
+	for _, bad := range []string{
+		"dockerfile: ../Dockerfile",
+		"context: /tmp",
+		"args: {SECRET: \"{{ .Secrets }}\"}",
+		"tags: [\"{{ .Name \"]",
+		"platforms: [linux]",
+		"platforms: [linux/amd64, linux/amd64]",
+	} {
+		_, err := parseConfigString(t, "service:\n  name: demo\n  build:\n    "+bad+"\n")
+		if err == nil {
+			t.Fatalf("build settings %q should be rejected", bad)
+		}
+	}
+}
+
+func TestImageDigest(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	cfg, err := config.ParseConfigData([]byte("service:\n  name: demo\n  registry: example.com\n  stage: production\n"+
+		"  currentVersion: v1.2.0\n  imageDigest: "+digest+"\n"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, pinned := cfg.GetImageRef(false)
+	if !pinned || ref != "example.com/demo@"+digest {
+		t.Fatalf("image is referenced as %s", ref)
+	}
+	if ref, pinned := cfg.GetImageRef(true); pinned || ref != "dev.local/demo:v1.2.0" {
+		t.Fatalf("local image is referenced as %s", ref)
+	}
+
+	_, err = parseConfigString(t, "service:\n  name: demo\n  imageDigest: "+digest+"\n")
+	if err == nil {
+		t.Fatal("image digest must not be accepted in the project config")
+	}
+	_, err = config.ParseConfigData([]byte("service:\n  name: demo\n  stage: production\n  imageDigest: sha256:abc\n"), true)
+	if err == nil {
+		t.Fatal("wrong image digest must be rejected")
+	}
+}
+
+func TestLocalConfig(t *testing.T) {
+	cfg, err := parseConfigString(t, "service:\n  name: demo\n  local:\n    loader: registry\n    registry: localhost:5001\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Local == nil || cfg.Local.Loader != "registry" || cfg.Local.Registry != "localhost:5001" {
+		t.Fatal("local cluster settings not parsed")
+	}
+	for _, bad := range []string{
+		"loader: docker",
+		"loader: kind\n    registry: localhost:5001",
+	} {
+		_, err := parseConfigString(t, "service:\n  name: demo\n  local:\n    "+bad+"\n")
+		if err == nil {
+			t.Fatalf("local cluster settings %q should be rejected", bad)
+		}
+	}
+}
+
+func TestDependencyWithoutEnvironment(t *testing.T) {
+	// Dependencies are deployed into the environment of the dependent, whether they declare it or not
+	dep, err := parseConfigString(t, `service:
+  name: dep
+  registry: registry.example.com/dev
+  currentVersion: v1.2.0
+  config:
+    LOG_LEVEL: info
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dep.ApplyEnvironment("staging"); err != nil {
+		t.Fatal(err)
+	}
+	if dep.Registry != "registry.example.com/dev" {
+		t.Fatal("undeclared environment changed the registry")
+	}
+	values, err := dep.GetConfig("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["LOG_LEVEL"] != "info" {
+		t.Fatal("undeclared environment must use the base config")
+	}
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/image/imagetest"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"reflect"
+	"testing"
+)
+
+func TestVersionOfTag(t *testing.T) {
+	for tag, expected := range map[string]*version.Version{
+		"v1.2.3":             version.New(1, 2, 3),
+		"v1.2.3-linux-arm64": version.New(1, 2, 3),
+		"v1.2.3-":            nil,
+		"1.2.3":              nil,
+		"v1":                 nil,
+		"latest":             nil,
+		"sha256-abc.sig":     nil,
+	} {
+		v := image.VersionOfTag(tag)
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("tag %s belongs to %v instead of %v", tag, v, expected)
+		}
+	}
+}
+
+func TestSupersededVersions(t *testing.T) {
+	versions := []version.Version{
+		*version.New(1, 2, 0),
+		*version.New(1, 2, 1),
+		*version.New(1, 2, 2),
+		*version.New(1, 2, 3),
+		*version.New(1, 2, 4),
+		*version.New(1, 3, 1),
+	}
+	protected := map[version.Version]bool{*version.New(1, 2, 1): true}
+	res := image.SupersededVersions(versions, protected, 2)
+	expected := []version.Version{*version.New(1, 2, 2)}
+	if !reflect.DeepEqual(res, expected) {
+		t.Fatalf("superseded versions are %v", res)
+	}
+	res = image.SupersededVersions(versions, nil, 0)
+	if len(res) != 5 {
+		t.Fatalf("production versions must be kept, got %v", res)
+	}
+}
+
+func TestDeleteTags(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+	repository := host + "/demo"
+	tags, err := image.ListTags(repository, authn.Anonymous)
+	if err != nil || len(tags) != 0 {
+		t.Fatalf("missing repository has tags %v: %v", tags, err)
+	}
+
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := image.Push(img, []string{repository + ":v1.2.3"}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags, err = image.ListTags(repository, authn.Anonymous)
+	if err != nil || !reflect.DeepEqual(tags, []string{"v1.2.3"}) {
+		t.Fatalf("repository has tags %v: %v", tags, err)
+	}
+	err = image.Delete(repository, digest, []string{"v1.2.3"}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := image.RemoteDigest(repository+":v1.2.3", authn.Anonymous)
+	if err != nil || existing != "" {
+		t.Fatalf("deleted image reported as %q: %v", existing, err)
+	}
+}
+
+func TestIndexChildren(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+	repository := host + "/demo"
+	amd64, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arm64, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx, err := image.Index([]v1.Image{amd64, arm64}, []string{"linux/amd64", "linux/arm64"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = image.Push(idx, []string{repository + ":v1.2.3"}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = image.Push(amd64, []string{repository + ":v1.2.4"}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var expected []string
+	for _, img := range []v1.Image{amd64, arm64} {
+		digest, err := img.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, digest.String())
+	}
+	children, err := image.Children(repository+":v1.2.3", authn.Anonymous)
+	if err != nil || !reflect.DeepEqual(children, expected) {
+		t.Fatalf("index lists %v instead of %v: %v", children, expected, err)
+	}
+	for _, tag := range []string{"v1.2.4", "v1.2.5"} {
+		children, err = image.Children(repository+":"+tag, authn.Anonymous)
+		if err != nil || len(children) != 0 {
+			t.Fatalf("tag %s lists platform images %v: %v", tag, children, err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package test
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/image/imagetest"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDaemonlessPush(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+
+	base, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseRef := host + "/base:latest"
+	_, err = image.Push(base, []string{baseRef}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifacts := t.TempDir()
+	err = os.WriteFile(filepath.Join(artifacts, "server"), []byte("binary"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pulled, err := image.Pull(baseRef, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := image.Assemble(pulled, artifacts, "/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err = image.WithLabels(img, map[string]string{"org.opencontainers.image.version": "1.2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err := image.RemoteDigest(host+"/demo:1.2.0", authn.Anonymous)
+	if err != nil || existing != "" {
+		t.Fatalf("missing tag reported as %q: %v", existing, err)
+	}
+	digest, err := image.Push(img, []string{host + "/demo:1.2.0", host + "/demo:latest"}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing, err = image.RemoteDigest(host+"/demo:1.2.0", authn.Anonymous)
+	if err != nil || existing != digest {
+		t.Fatalf("pushed tag reported as %q: %v", existing, err)
+	}
+
+	ref, err := name.ParseReference(host + "/demo:latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := remote.Image(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := pushed.Digest()
+	if err != nil || d.String() != digest {
+		t.Fatalf("extra tag points to %s instead of %s", d.String(), digest)
+	}
+	cfg, err := pushed.ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Config.Labels["org.opencontainers.image.version"] != "1.2.0" {
+		t.Fatal("labels are not set")
+	}
+	layers, err := pushed.Layers()
+	if err != nil || len(layers) != 2 {
+		t.Fatal("artifacts layer is not appended")
+	}
+
+	// The same artifacts must produce the same image
+	again, err := image.Assemble(pulled, artifacts, "/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err = image.WithLabels(again, map[string]string{"org.opencontainers.image.version": "1.2.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, _ := again.Digest(); d.String() != digest {
+		t.Fatal("assembling is not reproducible")
+	}
+}
+
+func TestLoadTarball(t *testing.T) {
+	img, err := random.Image(256, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(t.TempDir(), "image.tar")
+	ref, err := name.NewTag("example.com/demo:1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tarball.WriteToFile(p, ref, img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, cleanup, err := image.Load(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+	expected, _ := img.Digest()
+	actual, err := loaded.Digest()
+	if err != nil || actual != expected {
+		t.Fatal("loaded image differs")
+	}
+}
+
+func TestContextHash(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"image/Dockerfile": "FROM scratch",
+		"src/main.go":      "package main",
+		"build/out.log":    "first",
+		".dockerignore":    "# artifacts\nbuild\nimage\n",
+	}
+	for p, content := range files {
+		err := os.MkdirAll(filepath.Join(dir, filepath.Dir(p)), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(filepath.Join(dir, p), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	hash := func() string {
+		excludes, err := image.ContextExcludes(dir, "image/Dockerfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err := image.ContextHash(dir, excludes, "image/Dockerfile")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	initial := hash()
+	err := os.WriteFile(filepath.Join(dir, "build", "out.log"), []byte("second"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := hash(); h != initial {
+		t.Errorf("ignored files changed the hash")
+	}
+	// The Dockerfile is always sent to the daemon
+	err = os.WriteFile(filepath.Join(dir, "image", "Dockerfile"), []byte("FROM alpine"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := hash()
+	if changed == initial {
+		t.Errorf("the Dockerfile did not change the hash")
+	}
+	err = os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h := hash(); h == changed {
+		t.Errorf("sources did not change the hash")
+	}
+}
+
+func TestIndexPush(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+
+	var images []v1.Image
+	for i := 0; i < 2; i++ {
+		img, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		images = append(images, img)
+	}
+	platforms := []string{"linux/amd64", "linux/arm64"}
+	idx, err := image.Index(images, platforms, map[string]string{image.ContextHashLabel: "sha256:abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := image.Push(idx, []string{host + "/demo:1.2.0"}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels, existing, err := image.RemoteLabels(host+"/demo:1.2.0", authn.Anonymous)
+	if err != nil || existing != digest {
+		t.Fatalf("pushed index reported as %q: %v", existing, err)
+	}
+	if labels[image.ContextHashLabel] != "sha256:abc" {
+		t.Fatal("index annotations are not set")
+	}
+	ref, err := name.ParseReference(host + "/demo:1.2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushed, err := remote.Index(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := pushed.IndexManifest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Manifests) != 2 {
+		t.Fatalf("index has %d manifests", len(m.Manifests))
+	}
+	for i, d := range m.Manifests {
+		if d.Platform == nil || d.Platform.String() != platforms[i] {
+			t.Fatalf("manifest %d has platform %v", i, d.Platform)
+		}
+	}
+}
+
+func TestImageExists(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+	img, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := image.Push(img, []string{host + "/dev/demo:v1.2.0"}, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exists, err := image.Exists(host+"/dev/demo@"+digest, authn.Anonymous)
+	if err != nil || !exists {
+		t.Fatalf("pushed image reported as missing: %v", err)
+	}
+	// The digest is only pinned in the registry the image has been pushed to
+	exists, err = image.Exists(host+"/prod/demo@"+digest, authn.Anonymous)
+	if err != nil || exists {
+		t.Fatalf("image reported in a registry it has not been pushed to: %v", err)
+	}
+}
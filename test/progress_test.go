@@ -0,0 +1,95 @@
+package test
+
+import (
+	"bytes"
+	"errors"
+	"github.com/chill-cloud/chill-cli/pkg/progress"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderPlain(t *testing.T) {
+	stream := `{"stream":"Step 1/2 : FROM scratch\n"}
+{"status":"Pushing","id":"abc","progressDetail":{"current":1,"total":2}}
+{"status":"Pushed","id":"abc"}
+`
+	var out bytes.Buffer
+	err := progress.Render(strings.NewReader(stream), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Step 1/2 : FROM scratch\nabc: Pushed\n" {
+		t.Fatalf("rendered as %q", out.String())
+	}
+
+	err = progress.Render(strings.NewReader(stream+`{"errorDetail":{"message":"denied"},"error":"denied"}`), &out)
+	if err == nil || err.Error() != "denied" {
+		t.Fatalf("error in the stream reported as %v", err)
+	}
+	err = progress.Render(strings.NewReader("{"), &out)
+	if err == nil {
+		t.Fatal("malformed stream should be rejected")
+	}
+}
+
+func TestRenderUpdates(t *testing.T) {
+	updates := make(chan v1.Update, 3)
+	updates <- v1.Update{Total: 10, Complete: 5}
+	updates <- v1.Update{Error: errors.New("blob upload failed")}
+	close(updates)
+	stream := progress.FromUpdates("demo", "Pushing", updates)
+	defer stream.Close()
+	var out bytes.Buffer
+	err := progress.Render(stream, &out)
+	if err == nil || err.Error() != "blob upload failed" {
+		t.Fatalf("failed upload reported as %v", err)
+	}
+}
+
+func TestRenderUpdatesAfterError(t *testing.T) {
+	updates := make(chan v1.Update)
+	sent := make(chan struct{})
+	go func() {
+		defer close(sent)
+		defer close(updates)
+		updates <- v1.Update{Error: errors.New("blob upload failed")}
+		// Way more than any buffer between the sender and the renderer holds
+		for i := 0; i < 1000; i++ {
+			updates <- v1.Update{Total: 1000, Complete: int64(i)}
+		}
+	}()
+	var out bytes.Buffer
+	err := progress.RenderUpdates("demo", "Pushing", updates, &out)
+	if err == nil || err.Error() != "blob upload failed" {
+		t.Fatalf("failed upload reported as %v", err)
+	}
+	select {
+	case <-sent:
+	case <-time.After(10 * time.Second):
+		t.Fatal("sender blocked after the error was rendered")
+	}
+}
+
+func TestRenderPush(t *testing.T) {
+	stream := `{"status":"The push refers to repository [registry.example.com/team/demo]"}
+{"status":"Pushed","id":"abc"}
+{"status":"v1.2.0: digest: sha256:aaa size: 528"}
+{"progressDetail":{},"aux":{"Tag":"v1.2.0","Digest":"sha256:aaa","Size":528}}
+{"progressDetail":{},"aux":{"Tag":"latest","Digest":"sha256:aaa","Size":528}}
+`
+	var out bytes.Buffer
+	digests, err := progress.RenderPush(strings.NewReader(stream), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digests) != 2 || digests["v1.2.0"] != "sha256:aaa" || digests["latest"] != "sha256:aaa" {
+		t.Fatalf("wrong digests reported: %v", digests)
+	}
+
+	_, err = progress.RenderPush(strings.NewReader(`{"errorDetail":{"message":"denied"},"error":"denied"}`), &out)
+	if err == nil || err.Error() != "denied" {
+		t.Fatalf("error in the stream reported as %v", err)
+	}
+}
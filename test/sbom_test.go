@@ -0,0 +1,46 @@
+package test
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/image"
+	"github.com/chill-cloud/chill-cli/pkg/sbom"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGenerateSBOM(t *testing.T) {
+	base, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifacts := t.TempDir()
+	err = os.WriteFile(filepath.Join(artifacts, "server"), []byte("binary"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := image.Assemble(base, artifacts, "/app")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := sbom.Generate("demo", "1.2.0", []sbom.Image{{Ref: "example.com/demo:chill-1.2.0", Image: img}},
+		[]sbom.Dependency{{Name: "users", Version: "1.0.0", Location: "https://example.com/users.git"}, {Name: "auth", Version: "2.1.0"}},
+		sbom.Provenance{Builder: "chill-cli", Revision: "abc", ContextHash: "sha256:def"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Packages) != 3 || doc.Packages[1].Name != "auth" || doc.Packages[2].DownloadLocation != "git+https://example.com/users.git" {
+		t.Fatalf("packages are %v", doc.Packages)
+	}
+	var found bool
+	for _, f := range doc.Files {
+		found = found || f.Name == "./app/server"
+	}
+	if !found || len(doc.Packages[0].HasFiles) != len(doc.Files) || doc.Packages[0].VerificationCode == nil {
+		t.Fatal("files of the image are not described")
+	}
+	if len(doc.Relationships) != 3 || doc.Relationships[0].Type != "DESCRIBES" {
+		t.Fatalf("relationships are %v", doc.Relationships)
+	}
+}
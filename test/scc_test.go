@@ -50,3 +50,28 @@ func TestScc(t *testing.T) {
 		t.Fatal("cycle not found")
 	}
 }
+
+func TestTopologicalOrder(t *testing.T) {
+	g := validate.NewSccContext()
+	AddEdge(g, "a", "b")
+	AddEdge(g, "a", "c")
+	AddEdge(g, "b", "d")
+	AddEdge(g, "c", "d")
+	AddEdge(g, "e", "c")
+
+	order := g.TopologicalOrder()
+	if len(order) != 5 {
+		t.Fatal("wrong number of vertices")
+	}
+	pos := map[string]int{}
+	for i, v := range order {
+		pos[v] = i
+	}
+	for a, adj := range g.Adj {
+		for _, b := range adj {
+			if pos[b] > pos[a] {
+				t.Fatalf("%s must go before %s", b, a)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/chill-cloud/chill-cli/pkg/config"
+	"github.com/chill-cloud/chill-cli/pkg/image/imagetest"
+	"github.com/chill-cloud/chill-cli/pkg/signature"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	host := imagetest.NewRegistry(t)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "signing.key")
+	err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := signature.LoadPrivateKey(keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repository := host + "/demo"
+	digest := "sha256:" + strings.Repeat("a", 64)
+	other := "sha256:" + strings.Repeat("b", 64)
+	err = signature.Verify([]ed25519.PublicKey{public}, repository, digest, authn.Anonymous)
+	if err == nil {
+		t.Fatal("unsigned image verified")
+	}
+	err = signature.Sign(key, repository, digest, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signature.Verify([]ed25519.PublicKey{public}, repository, digest, authn.Anonymous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = signature.Verify([]ed25519.PublicKey{untrusted}, repository, digest, authn.Anonymous)
+	if err == nil {
+		t.Fatal("image verified by an untrusted key")
+	}
+	err = signature.Verify([]ed25519.PublicKey{public}, repository, other, authn.Anonymous)
+	if err == nil {
+		t.Fatal("signature applied to another digest")
+	}
+
+	encoded, err := signature.EncodePublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := parseConfigString(t, "service:\n  name: demo\n  signing:\n    publicKeys:\n      - |\n"+
+		"        "+strings.ReplaceAll(strings.TrimSpace(encoded), "\n", "\n        ")+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Signing.PublicKeys) != 1 || !cfg.Signing.PublicKeys[0].Equal(public) {
+		t.Fatal("public key not parsed")
+	}
+	_, err = config.ParseConfigData([]byte("service:\n  name: demo\n  signing:\n    publicKeys: [nope]\n"), false)
+	if err == nil {
+		t.Fatal("wrong public key accepted")
+	}
+}
@@ -0,0 +1,134 @@
+package test
+
+import (
+	"github.com/chill-cloud/chill-cli/pkg/cluster"
+	"github.com/chill-cloud/chill-cli/pkg/util"
+	"github.com/chill-cloud/chill-cli/pkg/version"
+	servingv1 "knative.dev/serving/pkg/apis/serving/v1"
+	"testing"
+)
+
+func TestRevisionTag(t *testing.T) {
+	v := version.Version{Major: 2, Minor: 3, Patch: 4}
+	tag := cluster.RevisionTag(v)
+	if tag != "v3-4" {
+		t.Fatal("wrong tag format")
+	}
+	res, err := cluster.ParseRevisionTag(tag, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Compare(v) != 0 {
+		t.Fatal("not reversible")
+	}
+	_, err = cluster.ParseRevisionTag("latest", 2)
+	if err == nil {
+		t.Fatal("wrong tag parsed")
+	}
+}
+
+func TestRetargetTraffic(t *testing.T) {
+	status := []servingv1.TrafficTarget{
+		{RevisionName: "a", Tag: "v1-0", Percent: util.Int64Ptr(0)},
+		{RevisionName: "b", Tag: "v2-0", Percent: util.Int64Ptr(100)},
+		{RevisionName: "c", Tag: "v2-1", Percent: util.Int64Ptr(0)},
+	}
+	res, err := cluster.RetargetTraffic(status, 1, map[version.Version]int64{
+		{Major: 1, Minor: 1, Patch: 0}: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatal("tagged revisions must stay in the route")
+	}
+	if *res[0].Percent != 100 || *res[1].Percent != 0 || *res[2].Percent != 0 {
+		t.Fatal("wrong traffic split")
+	}
+	if res[0].RevisionName != "a" {
+		t.Fatal("revision must be pinned")
+	}
+	_, err = cluster.RetargetTraffic(status, 1, map[version.Version]int64{
+		{Major: 1, Minor: 3, Patch: 0}: 100,
+	})
+	if err == nil {
+		t.Fatal("unknown revision accepted")
+	}
+	_, err = cluster.RetargetTraffic(status, 1, map[version.Version]int64{
+		{Major: 1, Minor: 1, Patch: 0}: 50,
+	})
+	if err == nil {
+		t.Fatal("wrong sum accepted")
+	}
+}
+
+func TestScaleTraffic(t *testing.T) {
+	v1 := version.Version{Major: 1, Minor: 1, Patch: 0}
+	v2 := version.Version{Major: 1, Minor: 2, Patch: 0}
+	v3 := version.Version{Major: 1, Minor: 3, Patch: 0}
+	res, err := cluster.ScaleTraffic(map[version.Version]int64{v1: 50, v2: 50}, v3, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[v3] != 5 || res[v1]+res[v2] != 95 || res[v1] < 47 || res[v2] < 47 {
+		t.Fatal("wrong scaled split")
+	}
+	res, err = cluster.ScaleTraffic(map[version.Version]int64{v1: 33, v2: 67}, v3, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res[v3] != 100 || res[v1] != 0 || res[v2] != 0 {
+		t.Fatal("full rollout must take all the traffic")
+	}
+	_, err = cluster.ScaleTraffic(map[version.Version]int64{}, v3, 50)
+	if err == nil {
+		t.Fatal("traffic split with nobody to receive the rest")
+	}
+}
+
+func TestScaleTrafficCanarySteps(t *testing.T) {
+	v1 := version.Version{Major: 1, Minor: 1, Patch: 0}
+	v2 := version.Version{Major: 1, Minor: 2, Patch: 0}
+	v3 := version.Version{Major: 1, Minor: 3, Patch: 0}
+	// Every step scales the split read before the rollout, not the one of the previous step
+	previous := map[version.Version]int64{v1: 70, v2: 30, v3: 0}
+	for _, tc := range []struct {
+		step     int64
+		expected map[version.Version]int64
+	}{
+		{step: 10, expected: map[version.Version]int64{v1: 63, v2: 27, v3: 10}},
+		{step: 50, expected: map[version.Version]int64{v1: 35, v2: 15, v3: 50}},
+		{step: 100, expected: map[version.Version]int64{v1: 0, v2: 0, v3: 100}},
+	} {
+		res, err := cluster.ScaleTraffic(previous, v3, tc.step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for v, p := range tc.expected {
+			if res[v] != p {
+				t.Fatalf("step %d: wrong split %v", tc.step, res)
+			}
+		}
+	}
+}
+
+func TestReplicaCounts(t *testing.T) {
+	v1 := version.Version{Major: 1, Minor: 1, Patch: 0}
+	v2 := version.Version{Major: 1, Minor: 2, Patch: 0}
+	res := cluster.ReplicaCounts(map[version.Version]int64{v1: 90, v2: 10}, 2, 0)
+	if res[v1] != 9 || res[v2] != 1 {
+		t.Fatalf("wrong replicas %v", res)
+	}
+	res = cluster.ReplicaCounts(map[version.Version]int64{v1: 100, v2: 0}, 3, 0)
+	if res[v1] != 3 || res[v2] != 0 {
+		t.Fatalf("wrong replicas %v", res)
+	}
+	res = cluster.ReplicaCounts(map[version.Version]int64{v1: 50, v2: 50}, 0, 0)
+	if res[v1] != 1 || res[v2] != 1 {
+		t.Fatalf("wrong replicas %v", res)
+	}
+	res = cluster.ReplicaCounts(map[version.Version]int64{v1: 99, v2: 1}, 1, 4)
+	if res[v1]+res[v2] != 4 {
+		t.Fatalf("max replicas exceeded %v", res)
+	}
+}